@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kopoli/gobu/pkg/build"
+)
+
+// configFile is the name of the project specific configuration file.
+const configFile = ".gobu"
+
+// config is the parsed configuration file. It maps section names to the
+// key-value pairs of the section.
+type config map[string]map[string]string
+
+// readConfig reads an INI-style configuration file. Lines are either
+// "[section]" headers or "key = value" pairs. Empty lines and lines starting
+// with '#' are ignored. A missing file results in an empty configuration.
+func readConfig(file string) (config, error) {
+	ret := make(config)
+
+	fp, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(fp)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := ret[section]; !ok {
+				ret[section] = make(map[string]string)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || section == "" {
+			return nil, fmt.Errorf("%s:%d: invalid line '%s'", file, lineno, line)
+		}
+		ret[section][key] = strings.TrimSpace(value)
+	}
+
+	return ret, scanner.Err()
+}
+
+// aliases returns the trait aliases of the configuration.
+func (c config) aliases() map[string][]string {
+	ret := make(map[string][]string)
+	for k, v := range c["aliases"] {
+		ret[k] = strings.Fields(v)
+	}
+	return ret
+}
+
+// allOs returns the operating systems of the all-os trait set in the
+// configuration.
+func (c config) allOs() []string {
+	return strings.Fields(c["targets"]["all-os"])
+}
+
+// profileSection is the section name prefix of named trait profiles.
+const profileSection = "profiles."
+
+// profile returns the traits of the named profile.
+func (c config) profile(name string) ([]string, error) {
+	if p, ok := c[profileSection+name]; ok {
+		return strings.Fields(p["traits"]), nil
+	}
+
+	var names []string
+	for _, k := range sortedKeys(c) {
+		if n, ok := strings.CutPrefix(k, profileSection); ok {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("profile %s not found: no profiles in %s", name, configFile)
+	}
+	return nil, fmt.Errorf("profile %s not found, available profiles: %s",
+		name, strings.Join(names, ", "))
+}
+
+// expandAliases replaces the aliases in names with the traits they stand
+// for. Aliases may refer to other aliases.
+func expandAliases(aliases map[string][]string, names []string, isTrait func(string) bool) ([]string, error) {
+	for k := range aliases {
+		if isTrait(k) {
+			return nil, fmt.Errorf("alias %s has the same name as a trait", k)
+		}
+	}
+
+	var expand func(names []string, seen []string) ([]string, error)
+	expand = func(names []string, seen []string) ([]string, error) {
+		var ret []string
+		for i := range names {
+			a, ok := aliases[names[i]]
+			if !ok {
+				ret = append(ret, names[i])
+				continue
+			}
+			for j := range seen {
+				if seen[j] == names[i] {
+					return nil, fmt.Errorf("alias cycle: %s -> %s",
+						strings.Join(seen[j:], " -> "), names[i])
+				}
+			}
+			e, err := expand(a, append(seen, names[i]))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, e...)
+		}
+		return ret, nil
+	}
+
+	return expand(names, nil)
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// traitDirective is the comment prefix for listing traits in the source of
+// the main package, e.g. "//gobu:traits nocgo release".
+const traitDirective = "//gobu:traits"
+
+// readTraitDirective returns the traits of the first trait directive found
+// in the main package of the given directory.
+func readTraitDirective(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for i := range files {
+		if strings.HasSuffix(files[i], "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(data, []byte(traitDirective)) {
+			continue
+		}
+
+		f, err := parser.ParseFile(token.NewFileSet(), files[i], data, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name != "main" {
+			continue
+		}
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				rest, ok := strings.CutPrefix(c.Text, traitDirective)
+				if ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+					return strings.Fields(rest), nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// mergeTraits returns the base traits that are not overridden by the given
+// traits followed by the given traits.
+func mergeTraits(base, traits []string) []string {
+	given := make(map[string]bool)
+	for i := range traits {
+		given[build.TraitName(traits[i])] = true
+	}
+
+	var ret []string
+	for i := range base {
+		if !given[build.TraitName(base[i])] {
+			ret = append(ret, base[i])
+		}
+	}
+	return append(ret, traits...)
+}
+
+// lastFile records the arguments of the last successful build.
+const lastFile = ".gobu.last"
+
+// readLastArgs returns the arguments recorded to the file, one per line.
+func readLastArgs(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no successful build has been recorded to %s", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// writeLastArgs records the arguments to the file, one per line.
+func writeLastArgs(file string, args []string) error {
+	var sb strings.Builder
+	for i := range args {
+		sb.WriteString(args[i] + "\n")
+	}
+	return os.WriteFile(file, []byte(sb.String()), 0644)
+}
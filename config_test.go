@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kopoli/gobu/pkg/build"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		content string
+		want    config
+		wantErr bool
+	}{
+		{"", config{}, false},
+		{"# comment\n\n[aliases]\nw = windows windowsgui\n",
+			config{"aliases": {"w": "windows windowsgui"}}, false},
+		{"[aliases]\n  rel=w release \n[aliases]\nx = nocgo\n",
+			config{"aliases": {"rel": "w release", "x": "nocgo"}}, false},
+		{"[ empty ]\n", config{"empty": {}}, false},
+		{"[aliases]\nw =\n", config{"aliases": {"w": ""}}, false},
+		{"w = windows\n", nil, true},
+		{"[aliases]\nwindows\n", nil, true},
+		{"[aliases]\n= windows\n", nil, true},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		file := filepath.Join(dir, fmt.Sprintf("config%d", i))
+		err := os.WriteFile(file, []byte(tt.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readConfig(file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("readConfig(%q) error = %v, want error %v", tt.content, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readConfig(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+
+	got, err := readConfig(filepath.Join(dir, "missing"))
+	if err != nil || len(got) != 0 {
+		t.Errorf("readConfig of a missing file = %v, %v, want an empty configuration", got, err)
+	}
+}
+
+func TestExpandAliases(t *testing.T) {
+	isTrait := build.New().HasTrait
+	tests := []struct {
+		aliases map[string][]string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{nil, []string{"nocgo", "linux"}, []string{"nocgo", "linux"}, false},
+		{map[string][]string{"w": {"windows", "shrink"}}, []string{"w", "name=x"},
+			[]string{"windows", "shrink", "name=x"}, false},
+		{map[string][]string{"w": {"windows"}, "rel": {"w", "release"}}, []string{"rel"},
+			[]string{"windows", "release"}, false},
+		{map[string][]string{"w": {"windows"}}, []string{"w", "w"},
+			[]string{"windows", "windows"}, false},
+		{map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"a"}, nil, true},
+		{map[string][]string{"a": {"nocgo", "a"}}, []string{"a"}, nil, true},
+		{map[string][]string{"nocgo": {"linux"}}, []string{"linux"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := expandAliases(tt.aliases, tt.names, isTrait)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("expandAliases(%v, %q) error = %v, want error %v", tt.aliases, tt.names, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("expandAliases(%v, %q) = %q, want %q", tt.aliases, tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTraits(t *testing.T) {
+	tests := []struct {
+		base   []string
+		traits []string
+		want   []string
+	}{
+		{nil, nil, nil},
+		{[]string{"nocgo", "linux"}, nil, []string{"nocgo", "linux"}},
+		{nil, []string{"release"}, []string{"release"}},
+		{[]string{"nocgo", "name=a"}, []string{"name=b"}, []string{"nocgo", "name=b"}},
+		{[]string{"linux", "release"}, []string{"release", "shrink"},
+			[]string{"linux", "release", "shrink"}},
+		{[]string{"tags=a", "tags=b"}, []string{"linux"}, []string{"tags=a", "tags=b", "linux"}},
+	}
+	for _, tt := range tests {
+		got := mergeTraits(tt.base, tt.traits)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("mergeTraits(%q, %q) = %q, want %q", tt.base, tt.traits, got, tt.want)
+		}
+	}
+}
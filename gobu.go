@@ -3,20 +3,20 @@ package main
 //go:generate licrep -o licenses.go
 
 import (
-	"archive/zip"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"sort"
+	"os/signal"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/kopoli/appkit"
+	"github.com/kopoli/gobu/pkg/build"
 )
 
 var (
@@ -27,396 +27,142 @@ var (
 	progVersion = "" + version
 )
 
-type gobu struct {
-	ldflags    []string
-	buildflags []string
-	gcflags    []string
-	environ    []string
-	givenOs    string
-	version    string
-	binary     string
-	subcmd     string
-	name       string
-	dopackage  bool
-}
-
-func (g *gobu) AddLdFlags(flags ...string) {
-	g.ldflags = append(g.ldflags, flags...)
-}
-
-func (g *gobu) ResetLdFlags() {
-	g.ldflags = nil
-}
-
-func (g *gobu) AddVar(name, value string) {
-	g.AddLdFlags("-X", fmt.Sprintf("%s=%s", name, value))
-}
-
-func (g *gobu) AddBuildFlags(flags ...string) {
-	g.buildflags = append(g.buildflags, flags...)
-}
-
-func (g *gobu) ResetBuildFlags() {
-	g.buildflags = nil
-}
-
-func (g *gobu) AddCompileFlags(flags ...string) {
-	g.gcflags = append(g.gcflags, flags...)
-}
-
-func (g *gobu) ResetCompileFlags() {
-	g.gcflags = nil
-}
+// Output of gobu and the go commands. These are teed to the log file if one
+// is given.
+var (
+	stdout  io.Writer = os.Stdout
+	stderr  io.Writer = os.Stderr
+	logFile *os.File
+)
 
-func (g *gobu) SetEnv(key, value string) {
-	g.environ = append(g.environ, fmt.Sprintf("%s=%s", key, value))
-	if key == "GOOS" {
-		g.givenOs = value
-	}
-	err := os.Setenv(key, value)
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
 	if err != nil {
-		fmt.Fprintf(os.Stderr,
-			"Error: Failed to set environment variable %s=%s: %s",
-			key, value, err)
+		return false
 	}
+	return fi.Mode()&os.ModeCharDevice != 0
 }
 
-func (g *gobu) TargetOs() string {
-	if g.givenOs != "" {
-		return g.givenOs
+func fault(err error, message string) {
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error: %s: %s\n", message, err)
+		exit(1)
 	}
-	return runtime.GOOS
 }
 
-func (g *gobu) Getcmd() (command []string, env []string) {
-	if g.binary == "" {
-		g.binary = "go"
+// openEvents returns the writer of the -events output: "stderr" or a file
+// descriptor number. The events written to stderr are also teed to the log
+// file.
+func openEvents(target string) (io.Writer, error) {
+	if target == "stderr" {
+		return stderr, nil
 	}
-	if g.subcmd == "" {
-		g.subcmd = "build"
+	fd, err := strconv.Atoi(target)
+	if err != nil || fd < 0 {
+		return nil, fmt.Errorf("invalid target %s: must be 'stderr' or a file descriptor", target)
 	}
-	command = append(command, g.binary, g.subcmd)
-
-	if g.buildflags != nil {
-		command = append(command, g.buildflags...)
+	fp := os.NewFile(uintptr(fd), "events")
+	if _, err := fp.Stat(); err != nil {
+		return nil, fmt.Errorf("invalid file descriptor %d: %w", fd, err)
 	}
-
-	if g.ldflags != nil {
-		command = append(command, "-ldflags", strings.Join(g.ldflags, " "))
-	}
-
-	if g.gcflags != nil {
-		command = append(command, "-gcflags", strings.Join(g.gcflags, " "))
-	}
-
-	return command, g.environ
+	return fp, nil
 }
 
-func (g *gobu) getTransformedBinaryName(name string) string {
-	if g.name != "" {
-		return strings.ReplaceAll(g.name, "%n", name)
-	}
-	return name
+// Exit codes of the failure phases
+const (
+	exitFailure   = 1
+	exitParse     = 2
+	exitBuild     = 3
+	exitPackage   = 4
+	exitSign      = 5
+	exitInterrupt = 130
+)
+
+// exitCode returns the exit code of the phase where the error happened.
+func exitCode(err error) int {
+	var perr *build.ParseError
+	var berr *build.BuildError
+	var pkgerr *build.PackageError
+	var signerr *build.SignError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupt
+	case errors.As(err, &perr):
+		return exitParse
+	case errors.As(err, &berr):
+		return exitBuild
+	case errors.As(err, &pkgerr):
+		return exitPackage
+	case errors.As(err, &signerr):
+		return exitSign
+	}
+	return exitFailure
 }
 
-func (g *gobu) getBinaryName() (string, error) {
-	archive, err := filepath.Abs(filepath.Dir(os.Args[0]))
+// parseFault reports the error in reading the traits and their
+// configuration and exits with the parse failure code.
+func parseFault(err error, message string) {
 	if err != nil {
-		return "", err
+		failOn(&build.ParseError{Message: message, Err: err})
 	}
-	return g.getTransformedBinaryName(filepath.Base(archive)), nil
 }
 
-// createPackage creates a zip package of the built binary and some extra
-// files. The environment variable GOBU_EXTRA_DIST can be used to include
-// additional files to the zip package.
-func (g *gobu) createPackage() error {
-	var err error
-	filestr := os.Getenv("GOBU_EXTRA_DIST")
-	files := []string{"README*", "LICENSE"}
-	if filestr != "" {
-		files = strings.Split(filestr, " ")
-	}
-
-	binary, err := g.getBinaryName()
+// failOn reports the error returned by the build library and exits with the
+// code of the failed phase.
+func failOn(err error) {
 	if err != nil {
-		return err
-	}
-	progname := binary
-	if g.version != "" {
-		progname = fmt.Sprintf("%s-%s-%s-%s", progname, g.version,
-			g.TargetOs(), runtime.GOARCH)
-	}
-	zipfile := fmt.Sprintf("%s.zip", progname)
-
-	if g.TargetOs() == "windows" {
-		binary += ".exe"
+		_, _ = fmt.Fprintf(stderr, "Error: %s\n", err)
+		exit(exitCode(err))
 	}
-	files = append(files, binary)
+}
 
-	fp, err := os.Create(zipfile)
+// openLog tees the output to the given file.
+func openLog(file string) error {
+	fp, err := os.Create(file)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		e2 := fp.Close()
-		if err == nil && e2 != nil {
-			err = e2
-		}
-	}()
-
-	w := zip.NewWriter(fp)
-	defer func() {
-		e2 := w.Close()
-		if err == nil && e2 != nil {
-			err = e2
-		}
-	}()
-
-	properfiles := []string{}
-	for i := range files {
-		var f []string
-		f, err = filepath.Glob(files[i])
-		if err != nil || len(f) == 0 {
-			continue
-		}
-
-		properfiles = append(properfiles, f...)
-	}
-	files = properfiles
-
-	for i := range files {
-		var fw io.Writer
-		fw, err = w.Create(fmt.Sprintf("%s/%s", progname, files[i]))
-		if err != nil {
-			return err
-		}
-		var rfp *os.File
-		rfp, err = os.Open(files[i])
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(fw, rfp)
-		if err != nil {
-			return err
-		}
-	}
-
-	return err
-}
-
-type traitdesc struct {
-	help       string
-	trait      func()
-	paramTrait func(string)
+	logFile = fp
+	stdout = io.MultiWriter(os.Stdout, fp)
+	stderr = io.MultiWriter(os.Stderr, fp)
+	return nil
 }
 
-type descmap map[string]traitdesc
-
-func (d *descmap) add(name, help string, trait func()) {
-	(*d)[name] = traitdesc{
-		help:       help,
-		trait:      trait,
-		paramTrait: nil,
-	}
-}
-
-func (d *descmap) addFlag(name, help string, trait func(string)) {
-	(*d)[name] = traitdesc{
-		help:       help,
-		trait:      nil,
-		paramTrait: trait,
-	}
-}
-
-type gobutraits struct {
-	traits  descmap
-	applied map[string]bool
-}
-
-func newgobutraits(gb *gobu) *gobutraits {
-	var ret = &gobutraits{
-		applied: make(map[string]bool),
-	}
-	t := make(descmap)
-
-	t.add("nocgo", "Set 'CGO_ENABLED=0' environment variable.", func() {
-		gb.SetEnv("CGO_ENABLED", "0")
-	})
-	t.add("static", "Set '-extldflags \"-static\"' link flags.", func() {
-		gb.AddLdFlags("-extldflags", `"-static"`)
-	})
-	t.add("shrink", "Set '-s -w' link flags.", func() {
-		gb.AddLdFlags("-s", "-w")
-	})
-	t.add("race", "Set '-race' build flag.", func() {
-		gb.AddBuildFlags("-race")
-	})
-	t.add("rebuild", "Set '-a' build flag.", func() {
-		gb.AddBuildFlags("-a")
-	})
-	t.add("trimpath", "Set '-trimpath' build flag.", func() {
-		gb.AddBuildFlags("-trimpath")
-	})
-	t.add("linux", "Set 'GOOS=linux' environment variable.", func() {
-		gb.SetEnv("GOOS", "linux")
-	})
-	t.add("windows", "Set 'GOOS=windows' environment variable.", func() {
-		gb.SetEnv("GOOS", "windows")
-	})
-	t.add("windowsgui", "Set windows trait and '-H windowsgui' link flag.", func() {
-		ret.apply("windows")
-		gb.AddLdFlags("-H", "windowsgui")
-	})
-	t.add("verbose", "Set '-v' build flag.", func() {
-		gb.AddBuildFlags("-v")
-	})
-	t.add("debug", "Set '-x' build flag.", func() {
-		gb.AddBuildFlags("-x")
-	})
-	t.add("install", "Run 'go install' instead of 'go build'.", func() {
-		gb.subcmd = "install"
-	})
-	t.add("version",
-		"Set 'timestamp', 'version', 'buildGOOS' and 'buildGOARCH' go variables to the 'main' package.", func() {
-			gb.AddVar("main.timestamp", time.Now().Format(time.RFC3339))
-			gb.AddVar("main.version", gb.version)
-			gb.AddVar("main.buildGOOS", runtime.GOOS)
-			gb.AddVar("main.buildGOARCH", runtime.GOARCH)
-		})
-	t.add("package", "After building creates a zip-package of the binary.", func() {
-		gb.dopackage = true
-	})
-	t.add("release", "Sets the traits: shrink, version, static, rebuild and trimpath.", func() {
-		ret.apply("shrink", "version", "static", "rebuild", "trimpath")
-	})
-	t.add("default", "Sets the version trait. This is used if run without arguments.", func() {
-		ret.apply("version")
-	})
-
-	t.addFlag("go=", "Set the 'go' binary explicitly.", func(s string) {
-		gb.binary = s
-	})
-	t.addFlag("tags=", "Set 'go build -tags' explicitly.", func(s string) {
-		gb.AddBuildFlags("-tags", s)
-	})
-	t.addFlag("ldflags=", "Set 'go tool link' flags explicitly.", func(s string) {
-		gb.ResetLdFlags()
-		gb.AddLdFlags(s)
-	})
-	t.addFlag("buildflags=", "Set 'go build' flags explicitly.", func(s string) {
-		gb.ResetBuildFlags()
-		gb.AddBuildFlags(s)
-	})
-	t.addFlag("gcflags=", "Set 'go tool compile' flags explicitly.", func(s string) {
-		gb.ResetCompileFlags()
-		gb.AddCompileFlags(s)
-	})
-	t.addFlag("name=", "Set binary name with the -o build flag. %n represents original name.", func(s string) {
-		gb.name = s
-		name, err := gb.getBinaryName()
-		if err != nil {
-			panic(err)
-		}
-		gb.AddBuildFlags("-o", name)
-	})
-	ret.traits = t
-
-	return ret
-}
-
-func isFlagTrait(name string) bool {
-	return strings.Contains(name, "=")
-}
-
-func parseTrait(name string) string {
-	return strings.SplitAfter(name, "=")[0]
-}
-
-func (g *gobutraits) check(names ...string) error {
-	inv := make(map[string]bool)
-
-	for i := range names {
-		n := parseTrait(names[i])
-		if _, ok := g.traits[n]; !ok {
-			inv[n] = true
-		}
-	}
-
-	suffix := "s"
-	switch len(inv) {
-	case 0:
-		return nil
-	case 1:
-		suffix = ""
-	}
-
-	var invalid []string
-	for k := range inv {
-		invalid = append(invalid, k)
-	}
-
-	return fmt.Errorf("invalid trait%s: %s", suffix, strings.Join(invalid, ", "))
-}
-
-func (g *gobutraits) apply(names ...string) {
-	for i := range names {
-		n := parseTrait(names[i])
-		if _, ok := g.applied[n]; ok {
-			continue
-		}
-		if t, ok := g.traits[n]; ok {
-			if isFlagTrait(n) {
-				t.paramTrait(strings.SplitN(names[i], "=", 2)[1])
-			} else {
-				t.trait()
-			}
-			g.applied[n] = true
+// exit closes the log file and exits with the given code.
+func exit(code int) {
+	if logFile != nil {
+		stdout, stderr = os.Stdout, os.Stderr
+		err := logFile.Close()
+		if err != nil && code == 0 {
+			fmt.Fprintf(os.Stderr, "Error: Closing log file failed: %s\n", err)
+			code = 1
 		}
 	}
-}
-
-func (g *gobutraits) appliedTraits() []string {
-	var ret []string
-
-	for k, v := range g.applied {
-		if v {
-			ret = append(ret, k)
-		}
-	}
-
-	return ret
-}
-
-func runCommand(args []string) error {
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
-}
-
-func cmdStr(args ...string) string {
-	cmd := exec.Command(args[0], args[1:]...)
-	out, err := cmd.Output()
-	if err != nil {
-		return ""
-	}
-	return strings.Trim(string(out), " \n\r\t")
-}
-
-func fault(err error, message string) {
-	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error: %s: %s\n", message, err)
-		os.Exit(1)
-	}
+	os.Exit(code)
 }
 
 var optVersion = flag.Bool("v", false, "Display version")
 var optListTraits = flag.Bool("l", false, "List traits")
+var optRaw = flag.Bool("raw", false, "With '-l', list traits as tab-separated name and description without alignment")
 var optDebug = flag.Bool("d", false, "Enable debug output")
 var optDryRun = flag.Bool("dryrun", false, "Don't actually run any commands. Implies '-d'.")
+var optCheck = flag.Bool("check", false, "With '-dryrun', show the commands the go toolchain would run with 'go build -n'")
+var optCacheStats = flag.Bool("cache-stats", false, "Report how many packages were taken from the build cache")
+var optStrict = flag.Bool("strict", false, "Fail the staticcheck trait if it reports any issues, even if staticcheck succeeds, and the valgrind= trait on any errors")
+var optQof = flag.Bool("qof", false, "Show the output of the commands only if they fail")
+var optEvents = flag.String("events", "", "Write build events as JSON Lines to 'stderr' or the given file descriptor")
+var optQuiet = flag.Bool("q", false, "Don't show progress output or the build summary")
+var optExplain = flag.Bool("explain", false, "Explain the effects of the given traits without building")
+var optProfile = flag.String("profile", "", "Apply the traits of the named profile from the configuration")
+var optLog = flag.String("log", "", "Write the build output also to the given file")
+var optCleanEnv = flag.Bool("clean-env", false, "Build with only PATH, HOME and the environment set by the traits")
+var optForce = flag.Bool("force", false, "Build even if the clean-tree trait finds uncommitted changes")
+var optRepeat = flag.Bool("repeat", false, "Repeat the traits and arguments of the last successful build")
+var optKeep = flag.Bool("keep", false, "Keep the files generated by the embed=, changelog, gen-completion= and auditenv traits after building")
+var optBump = flag.String("bump", "", "Tag the next 'major', 'minor' or 'patch' version of the latest git tag before building")
+var optSince = flag.String("since", "", "With the cmds trait, build only commands affected by changes since the given git ref")
+var optVerifyArchive = flag.String("verify-archive", "", "List the files of the given package archive with their checksums")
 var optLicenses = flag.Bool("licenses", false, "Show licenses of gobu.")
 
 func main() {
@@ -428,7 +174,7 @@ func main() {
 	opts.Set("program-buildgoarch", buildGOARCH)
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] [TRAIT ...]\n\nTraitful go build\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] [TRAIT ...] [-- ARGS ...]\n\nTraitful go build\n\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, "Command line options:")
 		flag.PrintDefaults()
 	}
@@ -449,67 +195,176 @@ func main() {
 		os.Exit(0)
 	}
 
-	gb := &gobu{
-		version: cmdStr("git", "describe", "--always", "--tags", "--dirty"),
+	if *optVerifyArchive != "" {
+		entries, err := build.ListArchive(*optVerifyArchive)
+		fault(err, "Reading archive failed")
+		wr := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(wr, "Mode\tSize\tSHA256\tName")
+		for _, e := range entries {
+			fmt.Fprintf(wr, "%s\t%d\t%s\t%s\n", e.Mode, e.Size, e.Sha256, e.Name)
+		}
+		wr.Flush()
+		os.Exit(0)
 	}
 
-	tr := newgobutraits(gb)
+	if *optLog != "" {
+		err := openLog(*optLog)
+		fault(err, "Opening log file failed")
+	}
+
+	if *optQof && *optQuiet {
+		failOn(&build.ParseError{Message: "Parsing flags failed",
+			Err: fmt.Errorf("-qof and -q can't be used together")})
+	}
+
+	gb := build.New()
+	gb.Stdout = stdout
+	gb.Stderr = stderr
+	gb.Debug = *optDebug
+	gb.DryRun = *optDryRun
+	gb.Progress = !*optQuiet && (*optDebug || isTerminal(os.Stderr))
+	gb.Quiet = *optQuiet
+	gb.QuietOnSuccess = *optQof
+	if *optEvents != "" {
+		events, err := openEvents(*optEvents)
+		parseFault(err, "Opening events output failed")
+		gb.Events = events
+	}
+	gb.Check = *optCheck
+	gb.CacheStats = *optCacheStats
+	gb.Strict = *optStrict
+	gb.CleanEnv = *optCleanEnv
+	gb.Since = *optSince
+	gb.Force = *optForce
+	gb.Keep = *optKeep
+	gb.GobuVersion = progVersion
+
+	cfg, err := readConfig(configFile)
+	parseFault(err, "Reading configuration failed")
+	aliases := cfg.aliases()
+	if oses := cfg.allOs(); len(oses) > 0 {
+		gb.AllOs = oses
+	}
+
+	if *optListTraits && *optRaw {
+		for _, t := range gb.Traits() {
+			fmt.Printf("%s\t%s\n", t.Name, t.Help)
+		}
+		for _, k := range sortedKeys(aliases) {
+			fmt.Printf("%s\t%s\n", k, strings.Join(aliases[k], " "))
+		}
+		exit(0)
+	}
 
 	if *optListTraits {
-		names := []string{}
-		for k := range tr.traits {
-			names = append(names, k)
-		}
-		sort.Strings(names)
+		traits := gb.Traits()
 
 		wr := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
 		fmt.Fprintln(wr, "Traits:")
 		printTrait := func(i int) {
-			fmt.Fprintf(wr, "  %s\t%s\n", names[i], tr.traits[names[i]].help)
+			fmt.Fprintf(wr, "  %s\t%s\n", traits[i].Name, traits[i].Help)
 		}
-		for i := range names {
-			if !isFlagTrait(names[i]) {
+		for i := range traits {
+			if !build.IsParameterized(traits[i].Name) {
 				printTrait(i)
 			}
 		}
 		fmt.Fprintln(wr, "\nParameterized traits:")
-		for i := range names {
-			if isFlagTrait(names[i]) {
+		for i := range traits {
+			if build.IsParameterized(traits[i].Name) {
 				printTrait(i)
 			}
 		}
+		if len(aliases) > 0 {
+			fmt.Fprintln(wr, "\nAliases:")
+			for _, k := range sortedKeys(aliases) {
+				fmt.Fprintf(wr, "  %s\t%s\n", k, strings.Join(aliases[k], " "))
+			}
+		}
 		wr.Flush()
-		os.Exit(0)
+		exit(0)
+	}
+
+	// The aliases are expanded in each source of traits before merging so
+	// that the traits they stand for override each other.
+	expand := func(traits []string) []string {
+		ret, err := expandAliases(aliases, traits, gb.HasTrait)
+		parseFault(err, "Expanding aliases failed")
+		return ret
+	}
+
+	directive, err := readTraitDirective(".")
+	parseFault(err, "Reading trait directive failed")
+	directive = expand(directive)
+
+	if *optProfile != "" {
+		profile, err := cfg.profile(*optProfile)
+		parseFault(err, "Selecting profile failed")
+		directive = mergeTraits(directive, expand(profile))
 	}
 
 	args := flag.Args()
+	if *optRepeat {
+		if len(args) > 0 {
+			parseFault(fmt.Errorf("traits can't be given with -repeat"), "Repeating the last build failed")
+		}
+		args, err = readLastArgs(lastFile)
+		parseFault(err, "Repeating the last build failed")
+	}
+	rawArgs := args
+	for i := range args {
+		if args[i] == "--" {
+			gb.SetArgs(args[i+1:]...)
+			args = args[:i]
+			break
+		}
+	}
+
+	args = mergeTraits(directive, expand(args))
 	if len(args) == 0 {
 		args = []string{"default"}
 	}
 
-	err := tr.check(args...)
-	fault(err, "Parsing command line failed")
-
-	tr.apply(args...)
-	c, e := gb.Getcmd()
-
-	if *optDebug || *optDryRun {
-		fmt.Printf("Traits:\n%s\nCommand:\n%s\nEnvironment:\n%s\n",
-			strings.Join(tr.appliedTraits(), " "),
-			strings.Join(c, " "), strings.Join(e, "\n"))
+	if *optExplain {
+		explanation, err := gb.Explain(args...)
+		failOn(err)
+		fmt.Println(strings.Join(explanation, "\n"))
+		exit(0)
 	}
 
-	if *optDryRun {
-		os.Exit(0)
+	if *optBump != "" {
+		tag, err := gb.Bump(*optBump)
+		parseFault(err, "Bumping version failed")
+		fmt.Fprintf(stdout, "Version: %s\n", tag)
 	}
 
-	err = runCommand(c)
-	fault(err, "Build failed")
+	err = gb.Apply(args...)
+	failOn(err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	if gb.dopackage {
-		err = gb.createPackage()
-		fault(err, "Creating package failed")
+	err = gb.Run(ctx)
+	failOn(err)
+
+	err = gb.Package(ctx)
+	failOn(err)
+
+	if *optDebug {
+		wr := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(wr, "Timings:")
+		for _, t := range gb.Timings() {
+			fmt.Fprintf(wr, "  %s\t%s\n", t.Name, t.Duration.Round(time.Millisecond))
+		}
+		wr.Flush()
+	}
+
+	if !*optDryRun {
+		err = writeLastArgs(lastFile, rawArgs)
+		if err != nil {
+			fmt.Fprintf(stderr, "Warning: Recording the build to %s failed: %s\n", lastFile, err)
+		}
 	}
 
-	os.Exit(0)
+	exit(0)
 }
@@ -0,0 +1,124 @@
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveEntry is a file in a package archive.
+type ArchiveEntry struct {
+	Name   string
+	Size   int64
+	Mode   fs.FileMode
+	Sha256 string
+}
+
+func hashReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func listZip(file string) ([]ArchiveEntry, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var ret []ArchiveEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		sum, size, err := hashReader(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		ret = append(ret, ArchiveEntry{f.Name, size, f.Mode(), sum})
+	}
+	return ret, nil
+}
+
+func listTar(r io.Reader) ([]ArchiveEntry, error) {
+	tr := tar.NewReader(r)
+
+	var ret []ArchiveEntry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		sum, size, err := hashReader(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		ret = append(ret, ArchiveEntry{hdr.Name, size, hdr.FileInfo().Mode(), sum})
+	}
+	return ret, nil
+}
+
+// ListArchive returns the regular files of a zip, tar, or gzip or zstd
+// compressed tar archive with their sha256 checksums.
+func ListArchive(file string) ([]ArchiveEntry, error) {
+	switch {
+	case strings.HasSuffix(file, ".zip"):
+		return listZip(file)
+	case strings.HasSuffix(file, ".tar"):
+		fp, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		return listTar(fp)
+	case strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		fp, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		zr, err := gzip.NewReader(fp)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return listTar(zr)
+	case strings.HasSuffix(file, ".tar.zst"):
+		fp, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+		zr, err := zstd.NewReader(fp)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return listTar(zr)
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", file)
+}
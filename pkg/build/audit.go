@@ -0,0 +1,76 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// auditFile is the build audit written by the auditenv trait.
+const auditFile = "build-audit.txt"
+
+// secretEnvWords are the parts of the names of the environment variables
+// whose values are redacted in the build audit.
+var secretEnvWords = []string{"TOKEN", "SECRET", "KEY", "PASSWORD"}
+
+// redactEnv returns the value of the environment variable or a placeholder
+// if the name suggests that the value is a secret.
+func redactEnv(name, value string) string {
+	upper := strings.ToUpper(name)
+	for _, w := range secretEnvWords {
+		if strings.Contains(upper, w) {
+			return "<redacted>"
+		}
+	}
+	return value
+}
+
+// buildAudit returns a description of how the binary is built: the
+// versions of gobu and go, the traits, the command and the environment of
+// the command.
+func (g *Gobu) buildAudit() (string, error) {
+	command, env, err := g.Getcmd()
+	if err != nil {
+		return "", err
+	}
+	traits := g.traits.appliedTraits()
+	sort.Strings(traits)
+
+	// Later values override the earlier ones as with exec
+	vars := map[string]string{}
+	for _, e := range g.commandEnv(env) {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			vars[kv[0]] = kv[1]
+		}
+	}
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "gobu version: %s\n", g.GobuVersion)
+	fmt.Fprintf(&sb, "go version: %s\n", cmdStr(g.binary, "env", "GOVERSION"))
+	fmt.Fprintf(&sb, "version: %s\n", g.Version())
+	fmt.Fprintf(&sb, "target: %s/%s\n", g.TargetOs(), g.TargetArch())
+	fmt.Fprintf(&sb, "traits: %s\n", strings.Join(traits, " "))
+	fmt.Fprintf(&sb, "command: %s\n", strings.Join(command, " "))
+	fmt.Fprintf(&sb, "environment:\n")
+	for _, k := range names {
+		fmt.Fprintf(&sb, "%s=%s\n", k, redactEnv(k, vars[k]))
+	}
+	return sb.String(), nil
+}
+
+// writeAudit writes the build audit of the auditenv trait. The file is
+// shared by all builds and is overwritten before each build is packaged.
+func (g *Gobu) writeAudit() error {
+	audit, err := g.buildAudit()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(auditFile, []byte(audit), 0644)
+}
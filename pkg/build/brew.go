@@ -0,0 +1,125 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// brewPlatforms maps GOOS and GOARCH values to Homebrew formula blocks.
+var brewPlatforms = map[string]string{
+	"darwin": "on_macos",
+	"linux":  "on_linux",
+	"amd64":  "on_intel",
+	"arm64":  "on_arm",
+}
+
+// sha256File returns the hex encoded SHA256 checksum of the file.
+func sha256File(file string) (string, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, fp)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// brewClassName converts the program name to a Ruby class name.
+func brewClassName(name string) string {
+	var ret strings.Builder
+	for _, f := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	}) {
+		ret.WriteString(strings.ToUpper(f[:1]) + f[1:])
+	}
+	return ret.String()
+}
+
+// expandDownloadURL replaces the placeholders {name}, {version}, {os},
+// {arch} and {file} of the URL pattern.
+func expandDownloadURL(pattern, name, version, goos, goarch, file string) (string, error) {
+	return expandPlaceholders(pattern, map[string]string{
+		"name":    name,
+		"version": version,
+		"os":      goos,
+		"arch":    goarch,
+		"file":    file,
+	})
+}
+
+// createFormula writes a Homebrew formula of the zip packages of the macOS
+// and linux builds. The download URLs are formed from the GOBU_DOWNLOAD_URL
+// environment variable.
+func (g *Gobu) createFormula(builds []*Gobu) error {
+	pattern := os.Getenv("GOBU_DOWNLOAD_URL")
+	if pattern == "" {
+		return fmt.Errorf("the GOBU_DOWNLOAD_URL environment variable is not set")
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+
+	// platform blocks in the order of the builds
+	var osOrder []string
+	blocks := make(map[string][]string)
+	for _, b := range builds {
+		osBlock, ok := brewPlatforms[b.TargetOs()]
+		archBlock, ok2 := brewPlatforms[b.TargetArch()]
+		if !ok || !ok2 {
+			fmt.Fprintf(g.Stderr, "Note: Skipping %s/%s in the Homebrew formula\n",
+				b.TargetOs(), b.TargetArch())
+			continue
+		}
+
+		progname, err := b.packageName()
+		if err != nil {
+			return err
+		}
+		file := progname + ".zip"
+		sum, err := sha256File(file)
+		if err != nil {
+			return err
+		}
+		binary, err := b.getBinaryName()
+		if err != nil {
+			return err
+		}
+
+		url, err := expandDownloadURL(pattern, name, b.Version(), b.TargetOs(), b.TargetArch(), file)
+		if err != nil {
+			return err
+		}
+		if _, ok := blocks[osBlock]; !ok {
+			osOrder = append(osOrder, osBlock)
+		}
+		blocks[osBlock] = append(blocks[osBlock], fmt.Sprintf(
+			"    %s do\n      url %q\n      sha256 %q\n\n      def install\n        bin.install %q\n      end\n    end\n",
+			archBlock, url, sum, binary))
+	}
+
+	if len(osOrder) == 0 {
+		return fmt.Errorf("no macOS or linux builds for the formula")
+	}
+
+	var f strings.Builder
+	fmt.Fprintf(&f, "class %s < Formula\n", brewClassName(name))
+	fmt.Fprintf(&f, "  desc %q\n", name)
+	fmt.Fprintf(&f, "  version %q\n", strings.TrimPrefix(g.Version(), "v"))
+	for _, o := range osOrder {
+		fmt.Fprintf(&f, "\n  %s do\n%s  end\n", o, strings.Join(blocks[o], "\n"))
+	}
+	fmt.Fprintf(&f, "end\n")
+
+	return os.WriteFile(name+".rb", []byte(f.String()), 0644)
+}
@@ -0,0 +1,1140 @@
+// Package build implements the traitful go build of gobu. The build is
+// configured by applying traits to a Gobu and then run with Run and Package.
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Gobu is the configuration of a build. It is created with New and
+// configured by applying traits.
+type Gobu struct {
+	// Output of gobu and the go commands
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Debug prints the generated commands before running them.
+	Debug bool
+	// DryRun only prints the generated commands.
+	DryRun bool
+	// Progress shows the progress of packaging.
+	Progress bool
+	// Check runs the go command with the -n flag when DryRun is set to show
+	// the commands the toolchain would run.
+	Check bool
+	// CacheStats runs the go command with the -x flag and reports how many
+	// packages were taken from the build cache.
+	CacheStats bool
+	// Strict fails the vet and staticcheck checks if they report any
+	// issues, even if the tool exits successfully, and the valgrind= trait
+	// if valgrind reports errors.
+	Strict bool
+	// QuietOnSuccess shows the output of the commands only if they fail.
+	QuietOnSuccess bool
+	// Events receives the build progress as JSON Lines events if set.
+	Events io.Writer
+	// Quiet suppresses the summary line after each build.
+	Quiet bool
+	// CleanEnv runs the go command in a minimal environment.
+	CleanEnv bool
+	// Keep keeps the files generated by the embed=, changelog,
+	// gen-completion= and auditenv traits after building.
+	Keep bool
+	// AllOs are the operating systems built with the all-os trait.
+	AllOs []string
+	// Force skips the check of the clean-tree trait.
+	Force bool
+	// Since limits the cmds trait to commands affected by changes since
+	// the given git ref.
+	Since string
+	// GobuVersion is the version of gobu recorded by the auditenv trait.
+	GobuVersion string
+
+	ldflags    []string
+	buildflags []string
+	gcflags    []string
+	testflags  []string
+	environ    []string
+	givenOs    string
+	givenArch  string
+	version    string
+	versionPkg string
+	binary     string
+	subcmd     string
+	name       string
+	dopackage  bool
+
+	// arguments given after the trait list
+	cmdargs []string
+	testpkg string
+
+	dockerImage  string
+	dobundle     bool
+	dodeb        bool
+	dorpm        bool
+	nfpmConfig   string
+	dobrew       bool
+	donotarize   bool
+	verifyStatic bool
+	verifyPaths  bool
+	verifyNoCgo  bool
+	targetsFile  string
+	buildCmds    bool
+	allOs        bool
+	cleanTree    bool
+	tidyCheck    bool
+	proxy        string
+	versions     []string
+	embedFiles   []string
+	dooci        bool
+	dozst        bool
+	printVersion bool
+	macUniversal bool
+	dochangelog  bool
+	matrixFile   string
+	removeSects  []string
+	smoke        bool
+	smokeArgs    []string
+	valgrind     bool
+	valgrindArgs []string
+	dotar        bool
+	provenance   bool
+	copyTo       string
+	mainPkgs     []string
+	// the builds of the mains= trait that are packaged together
+	suite      []*Gobu
+	splitDebug bool
+	linkmap    bool
+	zigTarget  string
+	// file listing the symbols kept by the keep-symbols= trait
+	keepSymbolsFile string
+	docomment       bool
+	comment         string
+	// subcommand of the gen-completion= trait that prints the completions
+	completionCmd []string
+	// directory of the man pages of the manpages= trait
+	manPages string
+	auditEnv bool
+	dosfx    bool
+	// certificate of the winsign= trait
+	winsignCert string
+
+	verifyReproducible bool
+
+	// arguments of staticcheck with the staticcheck trait
+	staticcheckArgs []string
+
+	// accumulated values of the cgo-cflags= and cgo-ldflags= traits
+	cgoCflags  []string
+	cgoLdflags []string
+	// accumulated values of the goexperiment= trait
+	goexperiments []string
+	// accumulated values of the goprivate= trait
+	goprivate []string
+
+	// module path and the import path of the package in the working
+	// directory
+	module     string
+	importPath string
+
+	traits  *gobutraits
+	builds  []*Gobu
+	timings []Timing
+
+	// record is called with a description of each change to the build
+	// configuration.
+	record func(effect string)
+}
+
+// New creates a build configuration. The go binary is taken from the
+// GOBU_GO_BINARY environment variable and the binary name template from
+// GOBU_NAME_TEMPLATE.
+func New() *Gobu {
+	g := &Gobu{
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		AllOs:      DefaultAllOs,
+		binary:     os.Getenv("GOBU_GO_BINARY"),
+		name:       os.Getenv("GOBU_NAME_TEMPLATE"),
+		subcmd:     "build",
+		versionPkg: defaultVersionPkg,
+	}
+	g.traits = newgobutraits(g)
+	return g
+}
+
+// SetArgs sets the arguments passed to the go command after the flags, e.g.
+// the packages to build.
+func (g *Gobu) SetArgs(args ...string) {
+	g.cmdargs = args
+}
+
+// Apply checks and applies the given traits. Warnings about conflicting
+// traits are written to Stderr.
+func (g *Gobu) Apply(traits ...string) error {
+	err := g.traits.check(traits...)
+	if err != nil {
+		return &ParseError{"Parsing traits failed", err}
+	}
+
+	g.traits.apply(traits...)
+	for _, c := range g.traits.conflicts() {
+		fmt.Fprintf(g.Stderr, "Warning: %s\n", c)
+	}
+	if g.testflags != nil && !g.capabilities().testflags {
+		fmt.Fprintf(g.Stderr, "Warning: Ignoring test flags for 'go %s': %s\n",
+			g.subcmd, strings.Join(g.testflags, " "))
+	}
+
+	if g.zigTarget != "" {
+		if m := g.zigTargetMismatch(g.zigTarget); m != "" {
+			fmt.Fprintf(g.Stderr, "Warning: %s\n", m)
+		}
+	}
+	for _, s := range g.unsupportedSanitizers() {
+		fmt.Fprintf(g.Stderr, "Warning: %s\n", s)
+	}
+	if g.QuietOnSuccess && g.traits.applied["verbose"] {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("verbose can't be used with quiet-on-success output")}
+	}
+	if g.matrixFile != "" && (g.targetsFile != "" || g.buildCmds || g.allOs || g.macUniversal) {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("matrix-file= can't be used with targets=, cmds, all-os or macos-universal")}
+	}
+	if len(g.mainPkgs) > 0 && (g.targetsFile != "" || g.buildCmds || g.allOs ||
+		g.macUniversal || g.matrixFile != "") {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("mains= can't be used with targets=, cmds, all-os, macos-universal or matrix-file=")}
+	}
+	if os.Getenv("GOBU_ARCHIVE_SPLIT") != "" && (g.dobrew || g.dosfx || g.donotarize || g.provenance) {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("GOBU_ARCHIVE_SPLIT can't be used with brew, sfx, notarize or provenance")}
+	}
+	if g.targetsFile != "" && g.buildCmds {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("targets= and cmds can't be used together")}
+	}
+	if g.allOs && (g.targetsFile != "" || g.buildCmds) {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("all-os can't be used with targets= or cmds")}
+	}
+	if g.macUniversal && (g.targetsFile != "" || g.buildCmds || g.allOs) {
+		return &ParseError{"Parsing traits failed",
+			fmt.Errorf("macos-universal can't be used with targets=, cmds or all-os")}
+	}
+
+	return nil
+}
+
+// targets returns the build configurations of each target.
+func (g *Gobu) targets() ([]*Gobu, error) {
+	var targets []buildTarget
+	var err error
+	switch {
+	case g.targetsFile != "":
+		targets, err = readTargets(g.targetsFile)
+		if err != nil {
+			return nil, &BuildError{"Reading targets failed", err}
+		}
+	case g.buildCmds:
+		targets, err = readCmdTargets(cmdDir)
+		if err != nil {
+			return nil, &BuildError{"Finding commands failed", err}
+		}
+		if g.Since != "" {
+			targets = g.changedCmdTargets(g.Since, targets)
+		}
+	case g.matrixFile != "":
+		targets, err = readMatrix(g.matrixFile)
+		if err != nil {
+			return nil, &BuildError{"Reading build matrix failed", err}
+		}
+	case len(g.mainPkgs) > 0:
+		targets = mainTargets(g.mainPkgs)
+	case g.allOs:
+		targets = osTargets(g.AllOs, g.TargetArch())
+	case g.macUniversal:
+		targets = universalTargets()
+	default:
+		return []*Gobu{g}, nil
+	}
+
+	var ret []*Gobu
+	for i := range targets {
+		ret = append(ret, g.forTarget(targets[i]))
+	}
+	return ret, nil
+}
+
+// Run runs the go command for each target of the build and the
+// verifications requested by the traits. The go command is killed if the
+// context is cancelled. With the versions= trait each version is also
+// packaged. With the print-version trait only the version is printed.
+func (g *Gobu) Run(ctx context.Context) error {
+	if g.printVersion {
+		fmt.Fprintln(g.Stdout, g.Version())
+		return nil
+	}
+
+	if g.cleanTree && !g.Force {
+		done := g.timing("clean-tree")
+		err := verifyCleanTree()
+		done()
+		if err != nil {
+			return &BuildError{"Working tree is not clean", err}
+		}
+	}
+
+	if g.tidyCheck && !g.DryRun {
+		done := g.timing("tidy-check")
+		err := g.runTidyCheck(ctx)
+		done()
+		if err != nil {
+			return &BuildError{"Checking go mod tidy failed", err}
+		}
+	}
+
+	if len(g.versions) > 0 {
+		return g.runVersions(ctx)
+	}
+
+	return g.run(ctx)
+}
+
+func (g *Gobu) run(ctx context.Context) error {
+	if g.moduleRequired() {
+		err := g.detectModule()
+		if err != nil {
+			return &BuildError{"Finding the go module failed", err}
+		}
+	}
+
+	builds, err := g.targets()
+	if err != nil {
+		return err
+	}
+	g.builds = builds
+
+	if len(g.embedFiles) > 0 && !g.DryRun {
+		done := g.timing("generate")
+		cleanup, err := g.createEmbed()
+		done()
+		if err != nil {
+			return &BuildError{"Embedding files failed", err}
+		}
+		if !g.Keep {
+			defer cleanup()
+		}
+	}
+
+	if g.dockerImage != "" && !g.DryRun {
+		err = g.verifyDockerImage(ctx, g.dockerImage)
+		if err != nil {
+			return &BuildError{"Verifying docker image failed", err}
+		}
+	}
+
+	if g.macUniversal && !g.DryRun {
+		err = findLipo()
+		if err != nil {
+			return &BuildError{"Creating universal binary failed", err}
+		}
+	}
+
+	for _, b := range builds {
+		target := map[string]interface{}{"os": b.TargetOs(), "arch": b.TargetArch()}
+		g.event("build-start", target)
+		start := time.Now()
+		done := g.timing(fmt.Sprintf("build %s/%s", b.TargetOs(), b.TargetArch()))
+		err := g.runTarget(ctx, b)
+		done()
+		g.event("build-end", endEvent(target, start, err))
+		if err != nil {
+			return err
+		}
+	}
+
+	if g.macUniversal {
+		done := g.timing("universal")
+		universal, err := g.createUniversal(ctx, builds)
+		done()
+		if err != nil {
+			return &BuildError{"Creating universal binary failed", err}
+		}
+		g.builds = []*Gobu{universal}
+	}
+
+	if len(g.mainPkgs) > 0 {
+		suite := *g
+		suite.builds = nil
+		suite.suite = builds
+		g.builds = []*Gobu{&suite}
+	}
+
+	return nil
+}
+
+// runTarget runs the go command of a target and the verifications requested
+// by the traits.
+func (g *Gobu) runTarget(ctx context.Context, b *Gobu) error {
+	c, e, err := b.Getcmd()
+	if err != nil {
+		return &BuildError{"Generating command failed", err}
+	}
+	gocmd := c
+	if b.dockerImage != "" {
+		c, err = dockerCommand(b.dockerImage, c, e)
+		if err != nil {
+			return &BuildError{"Generating docker command failed", err}
+		}
+	}
+
+	if g.Debug || g.DryRun {
+		fmt.Fprintf(g.Stdout, "Traits:\n%s\nModule:\n%s\nGo binary:\n%s\nCommand:\n%s\nEnvironment:\n%s\n",
+			strings.Join(g.traits.appliedTraits(), " "), g.module, b.binary,
+			strings.Join(c, " "), strings.Join(e, "\n"))
+	}
+
+	g.event("command", map[string]interface{}{"args": c, "env": append([]string{}, e...)})
+
+	if g.DryRun {
+		if b.winsignCert != "" && b.TargetOs() == "windows" {
+			_, shown, err := b.signCommand("<password file>")
+			if err != nil {
+				return &BuildError{"Generating command failed", err}
+			}
+			fmt.Fprintf(g.Stdout, "Sign:\n%s\n", strings.Join(shown, " "))
+		}
+		if b.copyTo != "" && b.capabilities().output {
+			binary, err := b.getBinaryPath()
+			if err != nil {
+				return &BuildError{"Generating command failed", err}
+			}
+			fmt.Fprintf(g.Stdout, "Copy:\n%s -> %s\n", binary, b.copyDestination(binary))
+		}
+		if g.Check {
+			err = b.checkCommand(ctx, gocmd, e)
+			if err != nil {
+				return &BuildError{"Checking the go command failed", err}
+			}
+		}
+		return nil
+	}
+
+	if b.subcmd == "staticcheck" {
+		if _, err := exec.LookPath("staticcheck"); err != nil {
+			fmt.Fprintf(g.Stderr, "Note: Skipping staticcheck: staticcheck was not found\n")
+			return nil
+		}
+	}
+
+	env := g.commandEnv(e)
+	start := time.Now()
+	switch {
+	case g.Strict && b.isCheck():
+		err = b.runStrict(ctx, c, env)
+	case g.CacheStats:
+		err = b.runWithCacheStats(ctx, c, env)
+	default:
+		err = b.runWithProxyFallback(ctx, c, env)
+	}
+	if err != nil {
+		return &BuildError{"Build failed", err}
+	}
+
+	if b.verifyStatic {
+		err = b.verifyStaticBinary()
+		if err != nil {
+			return &BuildError{"Verifying static binary failed", err}
+		}
+	}
+
+	if b.verifyNoCgo {
+		err = b.verifyNoCgoBinary(ctx)
+		if err != nil {
+			return &BuildError{"Verifying cgo is not used failed", err}
+		}
+	}
+
+	if b.verifyPaths {
+		err = b.verifyNoLocalPaths()
+		if err != nil {
+			return &BuildError{"Verifying local paths failed", err}
+		}
+	}
+
+	if b.verifyReproducible {
+		err = b.verifyReproducibleBuild(ctx, env)
+		if err != nil {
+			return &BuildError{"Verifying reproducible build failed", err}
+		}
+	}
+
+	if b.keepSymbolsFile != "" {
+		err = b.keepSymbols(ctx, b.keepSymbolsFile)
+		if err != nil {
+			return &BuildError{"Stripping symbols failed", err}
+		}
+	}
+
+	if b.linkmap {
+		err = b.writeLinkMap(ctx)
+		if err != nil {
+			return &BuildError{"Writing link map failed", err}
+		}
+	}
+
+	if b.splitDebug {
+		err = b.splitDebugInfo(ctx)
+		if err != nil {
+			return &BuildError{"Splitting debug information failed", err}
+		}
+	}
+
+	if len(b.removeSects) > 0 {
+		err = b.stripSections(ctx, b.removeSects)
+		if err != nil {
+			return &BuildError{"Stripping sections failed", err}
+		}
+	}
+
+	if b.winsignCert != "" {
+		err = b.signBinary(ctx)
+		if err != nil {
+			return &SignError{"Signing the binary failed", err}
+		}
+	}
+
+	if b.smoke {
+		err = b.runSmokeTest(ctx)
+		if err != nil {
+			return &BuildError{"Smoke test failed", err}
+		}
+	}
+
+	if b.valgrind {
+		err = b.runValgrind(ctx)
+		if err != nil {
+			return &BuildError{"Running under valgrind failed", err}
+		}
+	}
+
+	if b.copyTo != "" {
+		err = b.copyBinary()
+		if err != nil {
+			return &BuildError{"Copying the binary failed", err}
+		}
+	}
+
+	if !g.Quiet {
+		b.printSummary(time.Since(start))
+	}
+
+	return nil
+}
+
+// Package creates the packages requested by the package and bundle traits
+// from the builds of Run. Partially written packages are removed if the
+// context is cancelled.
+func (g *Gobu) Package(ctx context.Context) error {
+	if g.DryRun || g.printVersion || len(g.versions) > 0 {
+		return nil
+	}
+
+	g.event("package-start", nil)
+	start := time.Now()
+	done := g.timing("package")
+	err := g.createPackages(ctx)
+	done()
+	g.event("package-end", endEvent(nil, start, err))
+	return err
+}
+
+func (g *Gobu) createPackages(ctx context.Context) error {
+	if g.dochangelog {
+		cleanup, err := g.writeChangelog()
+		if err != nil {
+			return &PackageError{"Generating changelog failed", err}
+		}
+		if cleanup != nil && !g.Keep {
+			defer cleanup()
+		}
+	}
+
+	for _, b := range g.builds {
+		if len(b.completionCmd) == 0 {
+			continue
+		}
+		builds := b.suite
+		if len(builds) == 0 {
+			builds = []*Gobu{b}
+		}
+		for _, sb := range builds {
+			cleanup, err := sb.writeCompletions(ctx)
+			if err != nil {
+				return &PackageError{"Generating completions failed", err}
+			}
+			if cleanup != nil && !g.Keep {
+				defer cleanup()
+			}
+		}
+	}
+
+	if g.auditEnv && !g.Keep {
+		defer os.Remove(auditFile)
+	}
+
+	if g.dobundle {
+		err := g.createBundle(ctx, g.builds)
+		if err != nil {
+			return &PackageError{"Creating bundle failed", err}
+		}
+	}
+
+	for _, b := range g.builds {
+		if b.auditEnv {
+			err := b.writeAudit()
+			if err != nil {
+				return &PackageError{"Writing build audit failed", err}
+			}
+		}
+
+		if b.dopackage && !b.dobundle {
+			err := b.createPackage(ctx)
+			if err != nil {
+				return &PackageError{"Creating package failed", err}
+			}
+		}
+
+		if b.dosfx && b.dobundle && b.TargetOs() == "windows" {
+			fmt.Fprintf(g.Stderr, "Warning: Skipping self-extracting archive of %s/%s: bundles are not supported\n",
+				b.TargetOs(), b.TargetArch())
+		} else if b.dosfx {
+			err := b.createSfx(ctx)
+			if err != nil {
+				return &PackageError{"Creating self-extracting archive failed", err}
+			}
+		}
+
+		if b.donotarize && b.dobundle && b.TargetOs() == "darwin" {
+			fmt.Fprintf(g.Stderr, "Note: Skipping notarization of %s/%s: bundles are not notarized\n",
+				b.TargetOs(), b.TargetArch())
+		} else if b.donotarize {
+			err := b.notarize(ctx)
+			if err != nil {
+				return &SignError{"Notarizing failed", err}
+			}
+		}
+
+		if b.dotar {
+			err := b.createTar(ctx)
+			if err != nil {
+				return &PackageError{"Creating tar package failed", err}
+			}
+		}
+
+		if b.dozst {
+			err := b.createZst(ctx)
+			if err != nil {
+				return &PackageError{"Creating zstd package failed", err}
+			}
+		}
+
+		if b.dooci {
+			err := b.createOciImage()
+			if err != nil {
+				return &PackageError{"Creating OCI image failed", err}
+			}
+		}
+
+		if b.nfpmConfig != "" {
+			err := b.runNfpm(ctx, b.nfpmConfig)
+			if err != nil {
+				return &PackageError{"Creating nfpm package failed", err}
+			}
+			continue
+		}
+
+		if b.dodeb {
+			err := b.createDeb()
+			if err != nil {
+				return &PackageError{"Creating deb package failed", err}
+			}
+		}
+
+		if b.dorpm {
+			err := b.createRpm(ctx)
+			if err != nil {
+				return &PackageError{"Creating RPM package failed", err}
+			}
+		}
+	}
+
+	for _, b := range g.builds {
+		if b.provenance {
+			err := b.writeProvenance()
+			if err != nil {
+				return &PackageError{"Writing provenance failed", err}
+			}
+		}
+	}
+
+	if g.dobrew {
+		err := g.createFormula(g.builds)
+		if err != nil {
+			return &PackageError{"Creating Homebrew formula failed", err}
+		}
+	}
+
+	return nil
+}
+
+// formatSize returns the size in bytes in a human readable form.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// printSummary prints a line describing the successful run of the go
+// command.
+func (g *Gobu) printSummary(elapsed time.Duration) {
+	target := fmt.Sprintf("%s/%s", g.TargetOs(), g.TargetArch())
+	elapsed = elapsed.Round(10 * time.Millisecond)
+
+	switch g.subcmd {
+	case "build":
+		path, err := g.getBinaryPath()
+		if err != nil {
+			return
+		}
+		size := ""
+		if fi, err := os.Stat(path); err == nil {
+			size = fmt.Sprintf(" (%s)", formatSize(fi.Size()))
+		}
+		fmt.Fprintf(g.Stdout, "Built %s%s for %s in %s\n", path, size, target, elapsed)
+	case "install":
+		name, err := g.getBinaryName()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(g.Stdout, "Installed %s for %s in %s\n", name, target, elapsed)
+	case "test":
+		fmt.Fprintf(g.Stdout, "Tests passed for %s in %s\n", target, elapsed)
+	case "vet", "staticcheck":
+		fmt.Fprintf(g.Stdout, "Checks passed in %s\n", elapsed)
+	}
+}
+
+func (g *Gobu) note(format string, args ...interface{}) {
+	if g.record != nil {
+		g.record(fmt.Sprintf(format, args...))
+	}
+}
+
+func (g *Gobu) AddLdFlags(flags ...string) {
+	g.ldflags = append(g.ldflags, flags...)
+	g.note("link flags: %s", strings.Join(flags, " "))
+}
+
+func (g *Gobu) ResetLdFlags() {
+	g.ldflags = nil
+	g.note("link flags reset")
+}
+
+func (g *Gobu) AddVar(name, value string) {
+	g.AddLdFlags("-X", quoteFlag(fmt.Sprintf("%s=%s", name, value)))
+}
+
+// replaceVar changes the value of a go variable set with AddVar. It returns
+// false if the variable is not set.
+func (g *Gobu) replaceVar(name, value string) bool {
+	found := false
+	for i := range g.ldflags {
+		if i > 0 && g.ldflags[i-1] == "-X" &&
+			strings.HasPrefix(strings.Trim(g.ldflags[i], `'"`), name+"=") {
+			g.ldflags[i] = quoteFlag(fmt.Sprintf("%s=%s", name, value))
+			found = true
+		}
+	}
+	if found {
+		g.note("link flags: -X %s=%s", name, value)
+	}
+	return found
+}
+
+// buildTime returns the time of the build. It is taken from the
+// SOURCE_DATE_EPOCH environment variable for reproducible builds if set.
+func buildTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Now()
+}
+
+// quoteFlag quotes the flag so that the go tool keeps it as a single
+// argument when splitting the -ldflags value.
+func quoteFlag(s string) string {
+	if !strings.ContainsAny(s, " \t\n'\"") {
+		return s
+	}
+	if strings.Contains(s, "'") {
+		return `"` + s + `"`
+	}
+	return "'" + s + "'"
+}
+
+// ciBuildIDVars are the environment variables of CI systems that contain an
+// identifier of the build.
+var ciBuildIDVars = []string{"GITHUB_RUN_ID", "CI_PIPELINE_ID"}
+
+// ciBuildID returns the build identifier of the CI system if available.
+func ciBuildID() string {
+	for _, k := range ciBuildIDVars {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (g *Gobu) AddBuildFlags(flags ...string) {
+	g.buildflags = append(g.buildflags, flags...)
+	g.note("build flags: %s", strings.Join(flags, " "))
+}
+
+func (g *Gobu) ResetBuildFlags() {
+	g.buildflags = nil
+	g.note("build flags reset")
+}
+
+func (g *Gobu) AddCompileFlags(flags ...string) {
+	g.gcflags = append(g.gcflags, flags...)
+	g.note("compile flags: %s", strings.Join(flags, " "))
+}
+
+func (g *Gobu) ResetCompileFlags() {
+	g.gcflags = nil
+	g.note("compile flags reset")
+}
+
+// compileFlagArgs returns the -gcflags arguments of the compile flags. The
+// flags can be prefixed with a package pattern, e.g. "all=-N -l". The flags
+// of each pattern are combined to one -gcflags argument in the order the
+// patterns were first given. The flags without a pattern come first.
+func compileFlagArgs(gcflags []string) []string {
+	patterns := []string{""}
+	flags := map[string][]string{}
+	for _, f := range gcflags {
+		pattern := ""
+		if i := strings.Index(f, "="); i > 0 && !strings.HasPrefix(f, "-") {
+			pattern, f = f[:i], f[i+1:]
+		}
+		if _, ok := flags[pattern]; !ok && pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+		flags[pattern] = append(flags[pattern], f)
+	}
+	var ret []string
+	for _, p := range patterns {
+		if len(flags[p]) == 0 {
+			continue
+		}
+		arg := strings.Join(flags[p], " ")
+		if p != "" {
+			arg = p + "=" + arg
+		}
+		ret = append(ret, "-gcflags", arg)
+	}
+	return ret
+}
+
+func (g *Gobu) AddTestFlags(flags ...string) {
+	g.testflags = append(g.testflags, flags...)
+	g.note("test flags: %s", strings.Join(flags, " "))
+}
+
+func (g *Gobu) SetEnv(key, value string) {
+	entry := fmt.Sprintf("%s=%s", key, value)
+	replaced := false
+	for i := range g.environ {
+		if strings.HasPrefix(g.environ[i], key+"=") {
+			g.environ[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		g.environ = append(g.environ, entry)
+	}
+	g.note("environment: %s=%s", key, value)
+	switch key {
+	case "GOOS":
+		g.givenOs = value
+	case "GOARCH":
+		g.givenArch = value
+	}
+	err := os.Setenv(key, value)
+	if err != nil {
+		fmt.Fprintf(g.Stderr,
+			"Error: Failed to set environment variable %s=%s: %s",
+			key, value, err)
+	}
+}
+
+func (g *Gobu) TargetOs() string {
+	if g.givenOs != "" {
+		return g.givenOs
+	}
+	return runtime.GOOS
+}
+
+func (g *Gobu) TargetArch() string {
+	if g.givenArch != "" {
+		return g.givenArch
+	}
+	return runtime.GOARCH
+}
+
+// subcmdCaps tells which categories of flags a go subcommand accepts.
+type subcmdCaps struct {
+	buildflags bool
+	ldflags    bool
+	gcflags    bool
+	testflags  bool
+	output     bool
+}
+
+// subcmdCapabilities is indexed by the go subcommand. Subcommands not listed
+// are handled like "build".
+var subcmdCapabilities = map[string]subcmdCaps{
+	"build":   {buildflags: true, ldflags: true, gcflags: true, output: true},
+	"install": {buildflags: true, ldflags: true, gcflags: true},
+	"run":     {buildflags: true, ldflags: true, gcflags: true},
+	"test":    {buildflags: true, ldflags: true, gcflags: true, testflags: true},
+	"vet":     {buildflags: true},
+	"mod":     {},
+	"env":     {},
+
+	// staticcheck is run instead of the go command
+	"staticcheck": {},
+}
+
+func (g *Gobu) capabilities() subcmdCaps {
+	if c, ok := subcmdCapabilities[g.subcmd]; ok {
+		return c
+	}
+	return subcmdCapabilities["build"]
+}
+
+func (g *Gobu) Getcmd() (command []string, env []string, err error) {
+	if g.binary == "" {
+		g.binary = "go"
+	}
+	if g.subcmd == "" {
+		g.subcmd = "build"
+	}
+	if g.subcmd == "staticcheck" {
+		command = append([]string{"staticcheck"}, g.staticcheckArgs...)
+		if len(g.cmdargs) == 0 {
+			command = append(command, "./...")
+		}
+		return append(command, g.cmdargs...), g.environ, nil
+	}
+
+	command = append(command, g.binary, g.subcmd)
+	caps := g.capabilities()
+
+	if g.buildflags != nil && caps.buildflags {
+		command = append(command, g.buildflags...)
+	}
+
+	if g.name != "" && caps.output {
+		var output string
+		output, err = g.getBinaryPath()
+		if err != nil {
+			return nil, nil, err
+		}
+		command = append(command, "-o", output)
+	}
+
+	if g.ldflags != nil && caps.ldflags {
+		command = append(command, "-ldflags", strings.Join(g.ldflags, " "))
+	}
+
+	if g.gcflags != nil && caps.gcflags {
+		command = append(command, compileFlagArgs(g.gcflags)...)
+	}
+
+	if g.testflags != nil && caps.testflags {
+		command = append(command, g.testflags...)
+	}
+
+	switch {
+	case g.subcmd == "run" && len(g.cmdargs) == 0:
+		command = append(command, ".")
+	case g.subcmd == "test" && g.testpkg != "":
+		command = append(command, g.testpkg)
+	case g.subcmd == "test" && len(g.cmdargs) == 0:
+		command = append(command, "./...")
+	}
+	command = append(command, g.cmdargs...)
+
+	return command, g.environ, nil
+}
+
+// getTransformedBinaryName expands the name template of the name= trait.
+// The %n, %v, %o and %a placeholders are the original name, version, target
+// OS and target architecture.
+func (g *Gobu) getTransformedBinaryName(name string) string {
+	if g.name == "" {
+		return name
+	}
+	if !strings.Contains(g.name, "%") {
+		return g.name
+	}
+	return strings.NewReplacer(
+		"%n", name,
+		"%v", g.Version(),
+		"%o", g.TargetOs(),
+		"%a", g.TargetArch(),
+	).Replace(g.name)
+}
+
+// getBinaryName returns the name of the binary. By default it is derived
+// from the import path of the package like the go tool does, or from the
+// working directory outside modules.
+func (g *Gobu) getBinaryName() (string, error) {
+	name, err := g.getDefaultBinaryName()
+	if err != nil {
+		return "", err
+	}
+	return g.getTransformedBinaryName(name), nil
+}
+
+// getDefaultBinaryName returns the name of the binary without the name=
+// trait applied.
+func (g *Gobu) getDefaultBinaryName() (string, error) {
+	if g.importPath != "" {
+		return importPathBinaryName(g.importPath), nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(wd), nil
+}
+
+// getBinaryPath returns the path of the built binary including the
+// executable suffix of the target OS.
+func (g *Gobu) getBinaryPath() (string, error) {
+	binary, err := g.getBinaryName()
+	if err != nil {
+		return "", err
+	}
+	if g.TargetOs() == "windows" {
+		binary += ".exe"
+	}
+	return binary, nil
+}
+
+// cleanEnvVars are the environment variables kept in a clean build
+// environment.
+var cleanEnvVars = []string{
+	"PATH", "HOME",
+	// Needed by the go tool on windows
+	"SystemRoot", "USERPROFILE", "LOCALAPPDATA", "TMP", "TEMP",
+}
+
+// cleanEnviron returns a minimal environment with the given additions.
+func cleanEnviron(additions []string) []string {
+	var ret []string
+	for _, k := range cleanEnvVars {
+		if v, ok := os.LookupEnv(k); ok {
+			ret = append(ret, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	return append(ret, additions...)
+}
+
+// checkCommand runs the go command with the -n flag that prints the
+// commands of the toolchain without running them.
+func (g *Gobu) checkCommand(ctx context.Context, args []string, environ []string) error {
+	if !g.capabilities().buildflags {
+		fmt.Fprintf(g.Stderr, "Note: Skipping check: 'go %s' has no -n flag\n", g.subcmd)
+		return nil
+	}
+
+	args = append([]string{args[0], args[1], "-n"}, args[2:]...)
+	env := g.commandEnv(environ)
+
+	var buf bytes.Buffer
+	c := *g
+	c.Stdout = &buf
+	c.Stderr = &buf
+	c.QuietOnSuccess = false
+	err := c.runCommand(ctx, args, env)
+	fmt.Fprintf(g.Stdout, "Toolchain commands:\n%s", buf.String())
+	return err
+}
+
+// commandEnv returns the environment of the go command with the given
+// additions. The additions are needed even without CleanEnv as each target
+// has its own.
+func (g *Gobu) commandEnv(additions []string) []string {
+	if g.CleanEnv {
+		return cleanEnviron(additions)
+	}
+	return append(os.Environ(), additions...)
+}
+
+// runCommand runs the command with the given environment. If env is nil the
+// environment of gobu is inherited. With QuietOnSuccess the output is shown
+// only if the command fails.
+func (g *Gobu) runCommand(ctx context.Context, args []string, env []string) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdout = g.Stdout
+	cmd.Stderr = g.Stderr
+
+	var buf bytes.Buffer
+	if g.QuietOnSuccess {
+		cmd.Stdout = &buf
+		cmd.Stderr = &buf
+	}
+
+	err := cmd.Run()
+	if err != nil && g.QuietOnSuccess {
+		_, _ = buf.WriteTo(g.Stderr)
+	}
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+	return err
+}
+
+func cmdStr(args ...string) string {
+	cmd := exec.Command(args[0], args[1:]...)
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(out), " \n\r\t")
+}
@@ -0,0 +1,185 @@
+package build
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestGobu returns a build configuration with the given traits applied.
+// The environment variables set by the traits are restored after the test.
+func newTestGobu(t *testing.T, traits ...string) *Gobu {
+	t.Helper()
+	for _, k := range []string{"GOOS", "GOARCH", "CGO_ENABLED",
+		"GOBU_NAME_TEMPLATE", "GOBU_GO_BINARY"} {
+		t.Setenv(k, os.Getenv(k))
+	}
+	os.Unsetenv("GOBU_NAME_TEMPLATE")
+	os.Unsetenv("GOBU_GO_BINARY")
+
+	g := New()
+	g.Stdout = io.Discard
+	g.Stderr = io.Discard
+	err := g.Apply(traits...)
+	if err != nil {
+		t.Fatalf("Apply(%v) failed: %v", traits, err)
+	}
+	return g
+}
+
+// chdir changes the working directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+// flagValue returns the value following the flag in the command.
+func flagValue(command []string, flag string) (string, bool) {
+	for i := 0; i < len(command)-1; i++ {
+		if command[i] == flag {
+			return command[i+1], true
+		}
+	}
+	return "", false
+}
+
+func hasArg(command []string, arg string) bool {
+	for _, a := range command {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWindowsBinaryName(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	base := filepath.Base(dir)
+
+	tests := []struct {
+		traits []string
+		want   string
+	}{
+		{[]string{"windows", "name=app"}, "app.exe"},
+		{[]string{"windows", "name=%n-%o"}, base + "-windows.exe"},
+		{[]string{"windowsgui", "name=app"}, "app.exe"},
+		{[]string{"linux", "name=app"}, "app"},
+	}
+	for _, tt := range tests {
+		g := newTestGobu(t, tt.traits...)
+		command, _, err := g.Getcmd()
+		if err != nil {
+			t.Fatalf("%v: Getcmd failed: %v", tt.traits, err)
+		}
+		output, ok := flagValue(command, "-o")
+		if !ok || output != tt.want {
+			t.Errorf("%v: -o is %q, want %q", tt.traits, output, tt.want)
+			continue
+		}
+
+		binary, err := g.getBinaryPath()
+		if err != nil || binary != output {
+			t.Errorf("%v: getBinaryPath() = %q, %v, want %q", tt.traits, binary, err, output)
+		}
+
+		// The package contains the binary built with -o
+		err = os.WriteFile(output, nil, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := g.packageFiles()
+		if err != nil {
+			t.Fatalf("%v: packageFiles failed: %v", tt.traits, err)
+		}
+		if !hasArg(files, output) {
+			t.Errorf("%v: packageFiles() = %v, want it to contain %q", tt.traits, files, output)
+		}
+		os.Remove(output)
+	}
+}
+
+func TestSubcmdFlags(t *testing.T) {
+	tests := []struct {
+		subcmd    string
+		buildflag bool
+		ldflags   bool
+		gcflags   bool
+		testflag  bool
+		output    bool
+	}{
+		{"build", true, true, true, false, true},
+		{"test", true, true, true, true, false},
+		{"vet", true, false, false, false, false},
+		{"mod", false, false, false, false, false},
+	}
+	for _, tt := range tests {
+		g := newTestGobu(t, "race", "shrink", "gcflags=-m", "cover", "name=app")
+		g.subcmd = tt.subcmd
+		command, _, err := g.Getcmd()
+		if err != nil {
+			t.Fatalf("%s: Getcmd failed: %v", tt.subcmd, err)
+		}
+
+		checks := []struct {
+			flag string
+			want bool
+		}{
+			{"-race", tt.buildflag},
+			{"-ldflags", tt.ldflags},
+			{"-gcflags", tt.gcflags},
+			{"-cover", tt.testflag},
+			{"-o", tt.output},
+		}
+		for _, c := range checks {
+			if got := hasArg(command, c.flag); got != c.want {
+				t.Errorf("go %s: has %s = %v, want %v: %v", tt.subcmd, c.flag, got, c.want, command)
+			}
+		}
+	}
+}
+
+func TestCompileFlagArgs(t *testing.T) {
+	tests := []struct {
+		traits []string
+		want   []string
+	}{
+		{[]string{"addgcflags=-m"}, []string{"-gcflags", "-m"}},
+		{[]string{"addgcflags=all=-N -l", "addgcflags=example.com/app/...=-m"},
+			[]string{"-gcflags", "all=-N -l", "-gcflags", "example.com/app/...=-m"}},
+		{[]string{"addgcflags=all=-N", "addgcflags=std=-B", "addgcflags=all=-l"},
+			[]string{"-gcflags", "all=-N -l", "-gcflags", "std=-B"}},
+		{[]string{"addgcflags=all=-N -l", "addgcflags=-d=checkptr"},
+			[]string{"-gcflags", "-d=checkptr", "-gcflags", "all=-N -l"}},
+		{[]string{"gcflags=-m", "addgcflags=all=-l", "addgcflags=-B"},
+			[]string{"-gcflags", "-m -B", "-gcflags", "all=-l"}},
+		{[]string{"addgcflags=all=-l", "gcflags=all=-N -l"},
+			[]string{"-gcflags", "all=-N -l"}},
+	}
+	for _, tt := range tests {
+		g := newTestGobu(t, tt.traits...)
+		command, _, err := g.Getcmd()
+		if err != nil {
+			t.Fatalf("%v: Getcmd failed: %v", tt.traits, err)
+		}
+		var got []string
+		for i := 0; i < len(command)-1; i++ {
+			if command[i] == "-gcflags" {
+				got = append(got, command[i], command[i+1])
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%v: got %q, want %q", tt.traits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var semverTagRe = regexp.MustCompile(`^(v?)([0-9]+)\.([0-9]+)\.([0-9]+)$`)
+
+// nextVersion returns the tag with the given part of the version, major,
+// minor or patch, incremented.
+func nextVersion(tag, part string) (string, error) {
+	m := semverTagRe.FindStringSubmatch(tag)
+	if m == nil {
+		return "", fmt.Errorf("tag %s is not of the form vX.Y.Z", tag)
+	}
+	var v [3]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+2])
+	}
+
+	switch part {
+	case "major":
+		v = [3]int{v[0] + 1, 0, 0}
+	case "minor":
+		v = [3]int{v[0], v[1] + 1, 0}
+	case "patch":
+		v[2]++
+	default:
+		return "", fmt.Errorf("invalid version part %s: must be one of: major, minor, patch", part)
+	}
+
+	return fmt.Sprintf("%s%d.%d.%d", m[1], v[0], v[1], v[2]), nil
+}
+
+// Bump increments the given part, major, minor or patch, of the latest git
+// tag and creates an annotated tag of the new version. With DryRun the tag
+// is only computed. The new version is used by the traits, so Bump must be
+// called before Apply.
+func (g *Gobu) Bump(part string) (string, error) {
+	err := verifyCleanTree()
+	if err != nil {
+		return "", err
+	}
+
+	latest := cmdStr("git", "describe", "--tags", "--abbrev=0")
+	if latest == "" {
+		latest = "v0.0.0"
+	}
+	tag, err := nextVersion(latest, part)
+	if err != nil {
+		return "", err
+	}
+
+	if !g.DryRun {
+		err = g.runCommand(context.Background(), []string{"git", "tag", "-a", tag,
+			"-m", "Release " + tag}, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	g.version = tag
+	return tag, nil
+}
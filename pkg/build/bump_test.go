@@ -0,0 +1,35 @@
+package build
+
+import (
+	"testing"
+)
+
+func TestNextVersion(t *testing.T) {
+	tests := []struct {
+		tag     string
+		part    string
+		want    string
+		wantErr bool
+	}{
+		{"v1.2.3", "patch", "v1.2.4", false},
+		{"v1.2.3", "minor", "v1.3.0", false},
+		{"v1.2.3", "major", "v2.0.0", false},
+		{"1.2.3", "patch", "1.2.4", false},
+		{"v0.0.0", "minor", "v0.1.0", false},
+		{"v1.9.9", "patch", "v1.9.10", false},
+		{"v1.2.3", "build", "", true},
+		{"v1.2", "patch", "", true},
+		{"v1.2.3-rc1", "patch", "", true},
+		{"release", "major", "", true},
+	}
+	for _, tt := range tests {
+		got, err := nextVersion(tt.tag, tt.part)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("nextVersion(%q, %q) error = %v, want error %v", tt.tag, tt.part, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("nextVersion(%q, %q) = %q, want %q", tt.tag, tt.part, got, tt.want)
+		}
+	}
+}
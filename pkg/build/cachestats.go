@@ -0,0 +1,77 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// compileRe matches the invocations of the compiler in the 'go build -x'
+// output. The package path is given with the -p flag.
+var compileRe = regexp.MustCompile(`/compile(?:\.exe)?"? .*?-p (\S+)`)
+
+// compiledPackages returns the packages that were compiled according to the
+// output of 'go build -x'. The cached packages are not compiled.
+func compiledPackages(out string) map[string]bool {
+	ret := map[string]bool{}
+	for _, m := range compileRe.FindAllStringSubmatch(out, -1) {
+		ret[m[1]] = true
+	}
+	return ret
+}
+
+// listDeps returns the number of packages the build depends on.
+func (g *Gobu) listDeps(ctx context.Context, env []string) (int, error) {
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+	cmd := exec.CommandContext(ctx, gobin, append([]string{"list", "-deps"}, g.cmdargs...)...)
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+	return len(strings.Fields(string(out))), nil
+}
+
+// runWithCacheStats runs the go command with the -x flag and reports how
+// many of the packages of the build were taken from the build cache. The
+// output of -x is shown only if the command fails or the debug trait is
+// set.
+func (g *Gobu) runWithCacheStats(ctx context.Context, args []string, env []string) error {
+	if !g.capabilities().buildflags || g.dockerImage != "" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping cache stats: not supported for 'go %s'\n", g.subcmd)
+		return g.runWithProxyFallback(ctx, args, env)
+	}
+
+	args = append([]string{args[0], args[1], "-x"}, args[2:]...)
+
+	var buf bytes.Buffer
+	c := *g
+	c.Stderr = &buf
+	err := c.runWithProxyFallback(ctx, args, env)
+	if err != nil || g.traits.applied["debug"] {
+		_, _ = g.Stderr.Write(buf.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+
+	compiled := len(compiledPackages(buf.String()))
+	deps, err := g.listDeps(ctx, env)
+	if err != nil {
+		fmt.Fprintf(g.Stderr, "Warning: Skipping cache stats: listing packages failed: %s\n", err)
+		return nil
+	}
+	cached := deps - compiled
+	if cached < 0 {
+		cached = 0
+	}
+	fmt.Fprintf(g.Stderr, "Cache: %d of %d packages cached, %d compiled\n",
+		cached, deps, compiled)
+	return nil
+}
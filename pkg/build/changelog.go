@@ -0,0 +1,39 @@
+package build
+
+import (
+	"fmt"
+	"os"
+)
+
+// changelogFile is the changelog generated by the changelog trait.
+const changelogFile = "CHANGELOG"
+
+// changelog returns the commits since the previous tag, one line per
+// commit. All commits are listed if there is no previous tag.
+func changelog() string {
+	rng := "HEAD"
+	if prev := cmdStr("git", "describe", "--abbrev=0", "--tags", "HEAD^"); prev != "" {
+		rng = prev + "..HEAD"
+	}
+	return cmdStr("git", "log", "--format=%h %s", rng)
+}
+
+// writeChangelog generates the CHANGELOG file from the git log. The
+// returned function removes the file. Nothing is done outside git working
+// trees or if the file already exists.
+func (g *Gobu) writeChangelog() (cleanup func(), err error) {
+	if cmdStr("git", "rev-parse", "--is-inside-work-tree") != "true" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping changelog: not inside a git working tree\n")
+		return nil, nil
+	}
+	if _, err := os.Stat(changelogFile); err == nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping changelog: %s already exists\n", changelogFile)
+		return nil, nil
+	}
+
+	err = os.WriteFile(changelogFile, []byte(changelog()+"\n"), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return func() { os.Remove(changelogFile) }, nil
+}
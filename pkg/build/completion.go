@@ -0,0 +1,98 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// completionDir is the directory of the shell completions generated by the
+// gen-completion= trait.
+const completionDir = "completions"
+
+// completionShells are the shells whose completions are generated.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionFiles returns the completion files of the build for each of
+// the completionShells.
+func (g *Gobu) completionFiles() ([]string, error) {
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(binary), ".exe")
+	return []string{
+		filepath.Join(completionDir, name+".bash"),
+		filepath.Join(completionDir, "_"+name),
+		filepath.Join(completionDir, name+".fish"),
+	}, nil
+}
+
+// writeCompletions runs the built binary with the subcommand of the
+// gen-completion= trait and the shell name, e.g. 'app completion bash', and
+// writes the output to the completions directory. Cross-compiled binaries
+// are not run. The returned function removes the written files.
+func (g *Gobu) writeCompletions(ctx context.Context) (cleanup func(), err error) {
+	if g.TargetOs() != runtime.GOOS || g.TargetArch() != runtime.GOARCH {
+		fmt.Fprintf(g.Stderr, "Note: Skipping completions of a cross-compiled binary: %s/%s\n",
+			g.TargetOs(), g.TargetArch())
+		return nil, nil
+	}
+	if !g.capabilities().output {
+		fmt.Fprintf(g.Stderr, "Note: Skipping completions: 'go %s' does not produce a binary\n",
+			g.subcmd)
+		return nil, nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return nil, err
+	}
+	binary, err = filepath.Abs(binary)
+	if err != nil {
+		return nil, err
+	}
+	files, err := g.completionFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	cleanup = func() {
+		for _, f := range written {
+			_ = os.Remove(f)
+		}
+		// Only removed if nothing else is in it
+		_ = os.Remove(completionDir)
+	}
+	err = os.MkdirAll(completionDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	for i, shell := range completionShells {
+		var stdout, stderr bytes.Buffer
+		args := append(append([]string(nil), g.completionCmd...), shell)
+		cmd := exec.CommandContext(ctx, binary, args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			cleanup()
+			_, _ = stderr.WriteTo(g.Stderr)
+			return nil, fmt.Errorf("%s %s: %w", filepath.Base(binary),
+				strings.Join(args, " "), err)
+		}
+		err = os.WriteFile(files[i], stdout.Bytes(), 0644)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		written = append(written, files[i])
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,74 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copyDestination returns the path where the binary is copied by the
+// copyto= trait. If the destination is a directory or ends with a
+// separator, the binary is copied to it with its own name.
+func (g *Gobu) copyDestination(binary string) string {
+	dst := g.copyTo
+	if strings.HasSuffix(dst, "/") || strings.HasSuffix(dst, string(filepath.Separator)) {
+		return filepath.Join(dst, filepath.Base(binary))
+	}
+	if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+		return filepath.Join(dst, filepath.Base(binary))
+	}
+	return dst
+}
+
+// copyBinary copies the built binary to the destination of the copyto=
+// trait. The parent directories are created and the file mode is preserved.
+func (g *Gobu) copyBinary() error {
+	if !g.capabilities().output {
+		fmt.Fprintf(g.Stderr, "Note: Skipping copyto: 'go %s' does not produce a binary\n",
+			g.subcmd)
+		return nil
+	}
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	dst := g.copyDestination(binary)
+
+	in, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if e2 := out.Close(); err == nil {
+		err = e2
+	}
+	if err != nil {
+		return err
+	}
+	// The mode of an existing file is not changed by OpenFile
+	err = os.Chmod(dst, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if !g.Quiet {
+		fmt.Fprintf(g.Stdout, "Copied %s to %s\n", binary, dst)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// debArchs maps GOARCH values to Debian architectures.
+var debArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "amd64",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"mips64le": "mips64el",
+	"ppc64le":  "ppc64el",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// debVersion converts the version to a Debian package version, which must
+// start with a digit.
+func debVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	switch {
+	case version == "":
+		return "0.0.0"
+	case version[0] < '0' || version[0] > '9':
+		return "0.0.0~" + version
+	}
+	return version
+}
+
+// tarFile is a file to be written to a tar archive.
+type tarFile struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// writeTar writes the files as a tar archive. The header format is left
+// unset so that the writer uses USTAR when possible and PAX for long names,
+// and rounds the modification time to whole seconds.
+func writeTar(w io.Writer, files []tarFile, mtime time.Time) error {
+	tw := tar.NewWriter(w)
+
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    f.mode,
+			Size:    int64(len(f.data)),
+			ModTime: mtime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(f.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// tarGz creates a gzip compressed tar archive of the files.
+func tarGz(files []tarFile, mtime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	if err := writeTar(zw, files, mtime); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAr writes the files as an ar archive in the format used by Debian
+// packages.
+func writeAr(w io.Writer, files []tarFile, mtime time.Time) error {
+	_, err := io.WriteString(w, "!<arch>\n")
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		_, err = fmt.Fprintf(w, "%-16s%-12d%-6d%-6d%-8o%-10d`\n",
+			f.name, mtime.Unix(), 0, 0, f.mode, len(f.data))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(f.data)
+		if err != nil {
+			return err
+		}
+		if len(f.data)%2 != 0 {
+			_, err = w.Write([]byte{'\n'})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createDeb creates a Debian package with the built binary in /usr/bin. The
+// maintainer and description are taken from the GOBU_DEB_MAINTAINER and
+// GOBU_DEB_DESCRIPTION environment variables.
+func (g *Gobu) createDeb() error {
+	if g.TargetOs() != "linux" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping Debian package of a non-linux target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+
+	arch, ok := debArchs[g.TargetArch()]
+	if !ok {
+		return fmt.Errorf("unsupported architecture for Debian: %s", g.TargetArch())
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+	binary, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	pkg := filepath.Base(name)
+
+	maintainer := os.Getenv("GOBU_DEB_MAINTAINER")
+	if maintainer == "" {
+		maintainer = "Unknown <unknown@localhost>"
+	}
+	description := os.Getenv("GOBU_DEB_DESCRIPTION")
+	if description == "" {
+		description = pkg
+	}
+	version := debVersion(g.Version())
+
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\n"+
+		"Maintainer: %s\nInstalled-Size: %d\nSection: utils\nPriority: optional\n"+
+		"Description: %s\n",
+		pkg, version, arch, maintainer, (len(binary)+1023)/1024, description)
+
+	mtime := buildTime()
+	controlTar, err := tarGz([]tarFile{
+		{"./control", 0644, []byte(control)},
+	}, mtime)
+	if err != nil {
+		return err
+	}
+	dataTar, err := tarGz([]tarFile{
+		{"./usr/bin/" + pkg, 0755, binary},
+	}, mtime)
+	if err != nil {
+		return err
+	}
+
+	debfile := fmt.Sprintf("%s_%s_%s.deb", pkg, version, arch)
+	fp, err := os.Create(debfile)
+	if err != nil {
+		return err
+	}
+
+	err = writeAr(fp, []tarFile{
+		{"debian-binary", 0644, []byte("2.0\n")},
+		{"control.tar.gz", 0644, controlTar},
+		{"data.tar.gz", 0644, dataTar},
+	}, mtime)
+	e2 := fp.Close()
+	if err == nil {
+		err = e2
+	}
+	if err != nil {
+		_ = os.Remove(debfile)
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package build
+
+import (
+	"testing"
+)
+
+func TestDebVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", "0.0.0"},
+		{"v", "0.0.0"},
+		{"v1.2.3", "1.2.3"},
+		{"1.2.3", "1.2.3"},
+		{"v1.2.3-4-gabcdef", "1.2.3-4-gabcdef"},
+		{"abcdef", "0.0.0~abcdef"},
+		{"vnext", "0.0.0~next"},
+	}
+	for _, tt := range tests {
+		if got := debVersion(tt.version); got != tt.want {
+			t.Errorf("debVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
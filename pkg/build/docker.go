@@ -0,0 +1,69 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// dockerWorkDir is the directory where the working directory is mounted in
+// the container.
+const dockerWorkDir = "/src"
+
+var digestRe = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// validateDockerImage validates the image reference. An image pinned by
+// digest must have a valid sha256 digest.
+func validateDockerImage(image string) error {
+	if image == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if _, digest, ok := strings.Cut(image, "@"); ok && !digestRe.MatchString(digest) {
+		return fmt.Errorf("digest must be of the form sha256:<64 hex digits>")
+	}
+	return nil
+}
+
+// dockerCommand wraps the command to run in a container of the image with
+// the working directory mounted and the given environment set.
+func dockerCommand(image string, command []string, env []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{"docker", "run", "--rm",
+		"-v", fmt.Sprintf("%s:%s", wd, dockerWorkDir), "-w", dockerWorkDir}
+	for i := range env {
+		ret = append(ret, "-e", env[i])
+	}
+	ret = append(ret, image)
+	return append(ret, command...), nil
+}
+
+// verifyDockerImage pulls an image pinned by digest and checks that the
+// digest reported by the docker daemon matches. Images referred by tag are
+// not checked.
+func (g *Gobu) verifyDockerImage(ctx context.Context, image string) error {
+	_, digest, ok := strings.Cut(image, "@")
+	if !ok {
+		return nil
+	}
+
+	err := g.runCommand(ctx, []string{"docker", "pull", image}, nil)
+	if err != nil {
+		return err
+	}
+
+	out := cmdStr("docker", "image", "inspect", "--format",
+		`{{join .RepoDigests " "}}`, image)
+	for _, d := range strings.Fields(out) {
+		if strings.HasSuffix(d, "@"+digest) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("digest mismatch for image %s: the daemon reports '%s'", image, out)
+}
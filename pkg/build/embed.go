@@ -0,0 +1,95 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// embedDir is the directory where the files of the embed= trait are
+	// copied.
+	embedDir = "assets"
+	// embedSource is the generated source file that embeds the files.
+	embedSource = "embed.go"
+)
+
+const embedTemplate = `// Code generated by gobu. DO NOT EDIT.
+
+package main
+
+import "embed"
+
+//go:embed %s
+var assets embed.FS
+`
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// createEmbed copies the files of the embed= trait to the assets directory
+// and generates the source file that embeds them. The returned function
+// removes the generated files.
+func (g *Gobu) createEmbed() (cleanup func(), err error) {
+	for _, f := range []string{embedDir, embedSource} {
+		if _, err := os.Stat(f); err == nil {
+			return nil, fmt.Errorf("%s already exists", f)
+		}
+	}
+
+	cleanup = func() {
+		os.RemoveAll(embedDir)
+		os.Remove(embedSource)
+	}
+
+	err = os.Mkdir(embedDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]string{}
+	for _, f := range g.embedFiles {
+		name := filepath.Base(f)
+		if prev, ok := seen[name]; ok {
+			cleanup()
+			return nil, fmt.Errorf("%s and %s have the same name", prev, f)
+		}
+		seen[name] = f
+
+		err = copyFile(f, filepath.Join(embedDir, name))
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	err = os.WriteFile(embedSource, []byte(fmt.Sprintf(embedTemplate, embedDir)), 0644)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,38 @@
+package build
+
+// ParseError is returned when the traits can't be applied.
+type ParseError struct {
+	Message string
+	Err     error
+}
+
+func (e *ParseError) Error() string { return e.Message + ": " + e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// BuildError is returned when running the go command or verifying its
+// results fails.
+type BuildError struct {
+	Message string
+	Err     error
+}
+
+func (e *BuildError) Error() string { return e.Message + ": " + e.Err.Error() }
+func (e *BuildError) Unwrap() error { return e.Err }
+
+// PackageError is returned when creating a package fails.
+type PackageError struct {
+	Message string
+	Err     error
+}
+
+func (e *PackageError) Error() string { return e.Message + ": " + e.Err.Error() }
+func (e *PackageError) Unwrap() error { return e.Err }
+
+// SignError is returned when signing or notarizing the binary fails.
+type SignError struct {
+	Message string
+	Err     error
+}
+
+func (e *SignError) Error() string { return e.Message + ": " + e.Err.Error() }
+func (e *SignError) Unwrap() error { return e.Err }
@@ -0,0 +1,44 @@
+package build
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// event writes a JSON object of the given kind and fields as a line to
+// Events. Each event has the "time" and "event" fields.
+func (g *Gobu) event(kind string, fields map[string]interface{}) {
+	if g.Events == nil {
+		return
+	}
+
+	ev := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339Nano),
+		"event": kind,
+	}
+	for k, v := range fields {
+		ev[k] = v
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	_, _ = g.Events.Write(append(data, '\n'))
+}
+
+// endEvent returns the fields of an event ending a phase started at start.
+// The status is "ok" or "failed" with the error.
+func endEvent(fields map[string]interface{}, start time.Time, err error) map[string]interface{} {
+	ret := map[string]interface{}{
+		"status":      "ok",
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	for k, v := range fields {
+		ret[k] = v
+	}
+	if err != nil {
+		ret["status"] = "failed"
+		ret["error"] = err.Error()
+	}
+	return ret
+}
@@ -0,0 +1,39 @@
+package build
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// manDir is the directory of the man pages inside the packages.
+const manDir = "man"
+
+// manPageFiles returns the files in the directory of the manpages= trait.
+func (g *Gobu) manPageFiles() ([]string, error) {
+	var ret []string
+	err := filepath.WalkDir(g.manPages, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			ret = append(ret, path)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// archivePath returns the path of the file inside the packages. The files
+// of the manpages= trait are placed under the man directory with their
+// directory structure preserved.
+func (g *Gobu) archivePath(file string) string {
+	if g.manPages == "" {
+		return file
+	}
+	rel, err := filepath.Rel(g.manPages, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return file
+	}
+	return manDir + "/" + filepath.ToSlash(rel)
+}
@@ -0,0 +1,82 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// matrixTarget is a target of the build matrix file.
+type matrixTarget struct {
+	Os      string            `json:"os"`
+	Arch    string            `json:"arch"`
+	Name    string            `json:"name,omitempty"`
+	Package string            `json:"package,omitempty"`
+	Ldflags []string          `json:"ldflags,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// matrix is the content of the build matrix file.
+type matrix struct {
+	Targets []matrixTarget `json:"targets"`
+}
+
+// defaultMatrixName is the binary name of a matrix target without a name.
+const defaultMatrixName = "%n-%o-%a"
+
+// readMatrix reads the build targets from a JSON file of the form:
+//
+//	{"targets": [{"os": "linux", "arch": "amd64", "name": "app-%o-%a",
+//	  "package": "./cmd/app", "ldflags": ["-X main.edition=pro"],
+//	  "env": {"CGO_ENABLED": "0"}}]}
+//
+// Only the os and arch of each target are required.
+func readMatrix(file string) ([]buildTarget, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var m matrix
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(m.Targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", file)
+	}
+
+	var ret []buildTarget
+	for i, t := range m.Targets {
+		if t.Os == "" || t.Arch == "" {
+			entry, _ := json.Marshal(t)
+			return nil, fmt.Errorf("%s: target %d: os and arch are required: %s",
+				file, i+1, entry)
+		}
+		if t.Name == "" {
+			t.Name = defaultMatrixName
+		}
+		bt := buildTarget{goos: t.Os, goarch: t.Arch, name: t.Name, pkg: t.Package,
+			ldflags: t.Ldflags}
+		keys := make([]string, 0, len(t.Env))
+		for k := range t.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == "" {
+				entry, _ := json.Marshal(t)
+				return nil, fmt.Errorf("%s: target %d: empty environment variable name: %s",
+					file, i+1, entry)
+			}
+			bt.env = append(bt.env, k+"="+t.Env[k])
+		}
+		ret = append(ret, bt)
+	}
+
+	return ret, nil
+}
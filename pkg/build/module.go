@@ -0,0 +1,194 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// findModule returns the directory of the go.mod file in dir or its nearest
+// parent.
+func findModule(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		fi, err := os.Stat(filepath.Join(dir, "go.mod"))
+		if err == nil && !fi.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no go.mod found in the working directory or its parents")
+		}
+		dir = parent
+	}
+}
+
+// readModulePath returns the module path declared in the go.mod file.
+func readModulePath(gomod string) (string, error) {
+	fp, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		mod := fields[1]
+		if strings.HasPrefix(mod, `"`) || strings.HasPrefix(mod, "`") {
+			mod, err = strconv.Unquote(mod)
+			if err != nil {
+				return "", fmt.Errorf("%s: invalid module path: %s", gomod, fields[1])
+			}
+		}
+		return mod, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%s: no module directive", gomod)
+}
+
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// importPathBinaryName returns the name that the go tool gives to the binary
+// of the package with the given import path.
+func importPathBinaryName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersionRe.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	return name
+}
+
+// detectModule finds the module of the working directory and the import path
+// of the package in it.
+func (g *Gobu) detectModule() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir, err := findModule(wd)
+	if err != nil {
+		return err
+	}
+	mod, err := readModulePath(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, wd)
+	if err != nil {
+		return err
+	}
+
+	g.module = mod
+	g.importPath = path.Join(mod, filepath.ToSlash(rel))
+	return nil
+}
+
+// depsHash returns the sha256 hash of the go.sum file of the module in the
+// working directory. An empty string is returned if there is no go.sum.
+func depsHash() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	dir, err := findModule(wd)
+	if err != nil {
+		return "", err
+	}
+	gosum := filepath.Join(dir, "go.sum")
+	if _, err := os.Stat(gosum); os.IsNotExist(err) {
+		return "", nil
+	}
+	return sha256File(gosum)
+}
+
+// moduleRequired tells if the go subcommand needs a module to work.
+func (g *Gobu) moduleRequired() bool {
+	if os.Getenv("GO111MODULE") == "off" {
+		return false
+	}
+	switch g.subcmd {
+	case "build", "install", "run", "test", "vet":
+		return true
+	}
+	return false
+}
+
+// tidyCheck runs 'go mod tidy' and checks that it didn't change go.mod or
+// go.sum. The changes are reverted if it did.
+func (g *Gobu) runTidyCheck(ctx context.Context) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	dir, err := findModule(wd)
+	if err != nil {
+		return err
+	}
+
+	files := []string{filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum")}
+	saved := make(map[string][]byte)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err == nil {
+			saved[f] = data
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+	err = g.runCommand(ctx, []string{gobin, "mod", "tidy"}, g.commandEnv(g.environ))
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		orig, ok := saved[f]
+		if ok != (err == nil) || !bytes.Equal(orig, data) {
+			changed = append(changed, filepath.Base(f))
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	for _, f := range files {
+		if data, ok := saved[f]; ok {
+			err = os.WriteFile(f, data, 0644)
+		} else {
+			err = os.Remove(f)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("restoring %s failed: %w", f, err)
+		}
+	}
+	return fmt.Errorf("go mod tidy changed the module files: %s",
+		strings.Join(changed, ", "))
+}
@@ -0,0 +1,65 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// nfpmPackagers returns the nfpm packagers to run. The deb and rpm traits
+// select the packagers and deb is used by default.
+func (g *Gobu) nfpmPackagers() []string {
+	var ret []string
+	if g.dodeb {
+		ret = append(ret, "deb")
+	}
+	if g.dorpm {
+		ret = append(ret, "rpm")
+	}
+	if len(ret) == 0 {
+		ret = append(ret, "deb")
+	}
+	return ret
+}
+
+// runNfpm creates packages of the built binary with nfpm using the given
+// configuration file. The binary path, name, version and architecture are
+// passed to nfpm in the GOBU_BINARY, GOBU_NAME, GOBU_VERSION and GOBU_ARCH
+// environment variables.
+func (g *Gobu) runNfpm(ctx context.Context, config string) error {
+	if _, err := exec.LookPath("nfpm"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping nfpm packaging: nfpm was not found\n")
+		return nil
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	binary, err = filepath.Abs(binary)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		"GOBU_BINARY="+binary,
+		"GOBU_NAME="+name,
+		"GOBU_VERSION="+g.Version(),
+		"GOBU_ARCH="+g.TargetArch())
+
+	for _, p := range g.nfpmPackagers() {
+		err = g.runCommand(ctx, []string{"nfpm", "package", "-f", config,
+			"-p", p, "-t", "."}, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
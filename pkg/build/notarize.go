@@ -0,0 +1,56 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// notaryCredentials returns the notarytool arguments of the credentials.
+// Either a keychain profile stored with 'xcrun notarytool store-credentials'
+// or an App Store Connect API key file is used. Passwords are not accepted
+// as they would be visible in the process list.
+func notaryCredentials() ([]string, error) {
+	if profile := os.Getenv("GOBU_NOTARY_PROFILE"); profile != "" {
+		return []string{"--keychain-profile", profile}, nil
+	}
+	key := os.Getenv("GOBU_NOTARY_KEY")
+	keyID := os.Getenv("GOBU_NOTARY_KEY_ID")
+	issuer := os.Getenv("GOBU_NOTARY_ISSUER")
+	if key == "" || keyID == "" || issuer == "" {
+		return nil, fmt.Errorf("no credentials: set GOBU_NOTARY_PROFILE or " +
+			"GOBU_NOTARY_KEY, GOBU_NOTARY_KEY_ID and GOBU_NOTARY_ISSUER")
+	}
+	return []string{"--key", key, "--key-id", keyID, "--issuer", issuer}, nil
+}
+
+// notarize submits the zip package of a darwin build to the Apple notary
+// service with notarytool and waits for the result. Skipped outside macOS.
+func (g *Gobu) notarize(ctx context.Context) error {
+	if g.TargetOs() != "darwin" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping notarization of a non-darwin target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+	if _, err := exec.LookPath("xcrun"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping notarization: xcrun was not found, it is only available on macOS\n")
+		return nil
+	}
+
+	creds, err := notaryCredentials()
+	if err != nil {
+		return err
+	}
+	progname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"xcrun", "notarytool", "submit", progname + ".zip", "--wait"},
+		creds...)
+	if g.Debug {
+		fmt.Fprintf(g.Stdout, "Notarize:\n%s\n", strings.Join(args, " "))
+	}
+	return g.runCommand(ctx, args, nil)
+}
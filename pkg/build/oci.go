@@ -0,0 +1,195 @@
+package build
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	ociManifestType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociBlob is a content addressed file of the image layout.
+type ociBlob struct {
+	mediaType string
+	data      []byte
+}
+
+func (b ociBlob) digest() string {
+	sum := sha256.Sum256(b.data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (b ociBlob) path() string {
+	return "blobs/sha256/" + b.digest()[len("sha256:"):]
+}
+
+func (b ociBlob) descriptor() ociDescriptor {
+	return ociDescriptor{
+		MediaType: b.mediaType,
+		Digest:    b.digest(),
+		Size:      int64(len(b.data)),
+	}
+}
+
+func jsonBlob(mediaType string, v interface{}) (ociBlob, error) {
+	data, err := json.Marshal(v)
+	return ociBlob{mediaType, data}, err
+}
+
+var invalidImageTagRe = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// imageTag converts the version to a container image tag.
+func imageTag(version string) string {
+	tag := invalidImageTagRe.ReplaceAllString(version, "-")
+	if tag == "" || tag[0] == '.' || tag[0] == '-' {
+		tag = "latest"
+	}
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
+
+// createOciImage writes an OCI image layout tarball of the linux binary.
+// The image has no base layers and the binary as the entrypoint. The
+// tarball also contains a manifest.json for older docker versions.
+func (g *Gobu) createOciImage() error {
+	if g.TargetOs() != "linux" {
+		fmt.Fprintf(g.Stderr, "Warning: Skipping OCI image of a non-linux target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+	path, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	mtime := buildTime()
+	var layerTar bytes.Buffer
+	err = writeTar(&layerTar, []tarFile{{name, 0755, binary}}, mtime)
+	if err != nil {
+		return err
+	}
+	diffID := sha256.Sum256(layerTar.Bytes())
+
+	var layerGz bytes.Buffer
+	zw := gzip.NewWriter(&layerGz)
+	if _, err := zw.Write(layerTar.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	layer := ociBlob{ociLayerType, layerGz.Bytes()}
+
+	tag := imageTag(g.Version())
+	labels := map[string]string{
+		"org.opencontainers.image.title":   name,
+		"org.opencontainers.image.version": g.Version(),
+		"org.opencontainers.image.created": mtime.UTC().Format(time.RFC3339),
+	}
+
+	config, err := jsonBlob(ociConfigType, map[string]interface{}{
+		"created":      mtime.UTC().Format(time.RFC3339),
+		"architecture": g.TargetArch(),
+		"os":           "linux",
+		"config": map[string]interface{}{
+			"Entrypoint": []string{"/" + name},
+			"Labels":     labels,
+		},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{"sha256:" + hex.EncodeToString(diffID[:])},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	manifest, err := jsonBlob(ociManifestType, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociManifestType,
+		"config":        config.descriptor(),
+		"layers":        []ociDescriptor{layer.descriptor()},
+		"annotations":   labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	ref := fmt.Sprintf("%s:%s", name, tag)
+	desc := manifest.descriptor()
+	desc.Annotations = map[string]string{
+		"io.containerd.image.name":          ref,
+		"org.opencontainers.image.ref.name": tag,
+	}
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests":     []ociDescriptor{desc},
+	})
+	if err != nil {
+		return err
+	}
+
+	dockerManifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   config.path(),
+		"RepoTags": []string{ref},
+		"Layers":   []string{layer.path()},
+	}})
+	if err != nil {
+		return err
+	}
+
+	pkgname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+
+	files := []tarFile{
+		{"oci-layout", 0644, []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"index.json", 0644, index},
+		{"manifest.json", 0644, dockerManifest},
+	}
+	for _, b := range []ociBlob{layer, config, manifest} {
+		files = append(files, tarFile{b.path(), 0644, b.data})
+	}
+
+	fp, err := os.Create(pkgname + "-image.tar")
+	if err != nil {
+		return err
+	}
+	err = writeTar(fp, files, mtime)
+	if err != nil {
+		fp.Close()
+		os.Remove(fp.Name())
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,28 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.2.3", "v1.2.3"},
+		{"v1.2.3-4-gabcdef-dirty", "v1.2.3-4-gabcdef-dirty"},
+		{"v1.0+build.5", "v1.0-build.5"},
+		{"feature/x", "feature-x"},
+		{"", "latest"},
+		{".hidden", "latest"},
+		{"-dash", "latest"},
+		{"/slash", "latest"},
+		{strings.Repeat("a", 200), strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		if got := imageTag(tt.version); got != tt.want {
+			t.Errorf("imageTag(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package build
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// packageFiles returns the built binaries and the extra files to be
+// packaged. With the mains= trait the binaries of all the main packages are
+// included. The environment variable GOBU_EXTRA_DIST and the file given with
+// GOBU_EXTRA_DIST_FILE can be used to include additional files to the
+// package.
+func (g *Gobu) packageFiles() ([]string, error) {
+	filestr := os.Getenv("GOBU_EXTRA_DIST")
+	files := []string{"README*", "LICENSE"}
+	if filestr != "" {
+		files = strings.Split(filestr, " ")
+	}
+	if distfile := os.Getenv("GOBU_EXTRA_DIST_FILE"); distfile != "" {
+		extra, err := readDistFile(distfile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, extra...)
+	}
+
+	if g.dochangelog {
+		files = append(files, changelogFile)
+	}
+	if g.auditEnv {
+		files = append(files, auditFile)
+	}
+	if g.manPages != "" {
+		manpages, err := g.manPageFiles()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, manpages...)
+	}
+	builds := g.suite
+	if len(builds) == 0 {
+		builds = []*Gobu{g}
+	}
+	for _, b := range builds {
+		binary, err := b.getBinaryPath()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, binary)
+		if g.splitDebug {
+			files = append(files, binary+debugSuffix)
+		}
+		if g.linkmap {
+			files = append(files, binary+mapSuffix)
+		}
+		if len(g.completionCmd) > 0 {
+			completions, err := b.completionFiles()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, completions...)
+		}
+	}
+
+	properfiles := []string{}
+	for i := range files {
+		f, err := filepath.Glob(files[i])
+		if err != nil || len(f) == 0 {
+			continue
+		}
+
+		properfiles = append(properfiles, f...)
+	}
+
+	return properfiles, nil
+}
+
+// readDistFile reads the globs of the extra files of the packages from the
+// file, one per line. Blank lines and lines starting with # are ignored.
+func readDistFile(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading GOBU_EXTRA_DIST_FILE failed: %w", err)
+	}
+	var ret []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret, nil
+}
+
+// createZip creates the zip file and calls write to fill it. The partial
+// file is removed if writing fails or is cancelled.
+func createZip(zipfile string, write func(w *zip.Writer) error) (err error) {
+	fp, remove, err := createArchiveFile(zipfile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e2 := fp.Close()
+		if err == nil && e2 != nil {
+			err = e2
+		}
+		if err != nil {
+			remove()
+		}
+	}()
+
+	w := zip.NewWriter(fp)
+	defer func() {
+		e2 := w.Close()
+		if err == nil && e2 != nil {
+			err = e2
+		}
+	}()
+
+	return write(w)
+}
+
+// packageJobs returns the number of files read concurrently when packaging.
+// It is taken from the GOBU_PACKAGE_JOBS environment variable and defaults
+// to the number of CPUs.
+func packageJobs() (int, error) {
+	s := os.Getenv("GOBU_PACKAGE_JOBS")
+	if s == "" {
+		return runtime.NumCPU(), nil
+	}
+	jobs, err := strconv.Atoi(s)
+	if err != nil || jobs < 1 {
+		return 0, fmt.Errorf("invalid GOBU_PACKAGE_JOBS '%s': must be a positive integer", s)
+	}
+	return jobs, nil
+}
+
+// readPackageFiles reads the files concurrently and calls write with the
+// content of each file in the order of the files. At most the number of
+// packageJobs files are held in memory at a time. Reading is stopped at the
+// first error.
+func (g *Gobu) readPackageFiles(ctx context.Context, files []string, write func(i int, data []byte) error) error {
+	jobs, err := packageJobs()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan result, len(files))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	sem := make(chan struct{}, jobs)
+	go func() {
+		for i := range files {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int) {
+				data, err := os.ReadFile(files[i])
+				results[i] <- result{data, err}
+			}(i)
+		}
+	}()
+
+	for i := range files {
+		var r result
+		select {
+		case r = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-sem
+		if r.err != nil {
+			return r.err
+		}
+		if g.Progress {
+			fmt.Fprintf(g.Stderr, "packaging %d/%d: %s\n", i+1, len(files), files[i])
+		}
+		err = write(i, r.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeZipFiles writes the files to the zip under the given directory.
+func (g *Gobu) writeZipFiles(ctx context.Context, w *zip.Writer, dir string, files []string) error {
+	return g.readPackageFiles(ctx, files, func(i int, data []byte) error {
+		fw, err := w.Create(fmt.Sprintf("%s/%s", dir, g.archivePath(files[i])))
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+}
+
+var placeholderRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// expandPlaceholders replaces the {key} placeholders of the template with
+// the values. Unknown placeholders are an error.
+func expandPlaceholders(template string, values map[string]string) (string, error) {
+	var unknown []string
+	ret := placeholderRe.ReplaceAllStringFunc(template, func(p string) string {
+		v, ok := values[p[1:len(p)-1]]
+		if !ok {
+			unknown = append(unknown, p)
+		}
+		return v
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholders in '%s': %s", template,
+			strings.Join(unknown, ", "))
+	}
+	return ret, nil
+}
+
+// packageName returns the name of the package without the file extension.
+// It is also the directory inside the package. The name can be set with the
+// GOBU_ARCHIVE_TEMPLATE environment variable and the separator of the
+// default name with GOBU_NAME_SEP.
+func (g *Gobu) packageName() (string, error) {
+	getName := g.getBinaryName
+	if g.allOs {
+		// The binary names already contain the platform
+		getName = g.getDefaultBinaryName
+	}
+	binary, err := getName()
+	if err != nil {
+		return "", err
+	}
+
+	if tmpl := os.Getenv("GOBU_ARCHIVE_TEMPLATE"); tmpl != "" {
+		return expandPlaceholders(tmpl, map[string]string{
+			"name":    binary,
+			"version": g.Version(),
+			"os":      g.TargetOs(),
+			"arch":    g.TargetArch(),
+		})
+	}
+
+	return strings.Join([]string{binary, g.Version(), g.TargetOs(), g.TargetArch()},
+		nameSep()), nil
+}
+
+// nameSep returns the separator of the parts of the package names. It is
+// taken from the GOBU_NAME_SEP environment variable and defaults to "-".
+func nameSep() string {
+	if sep, ok := os.LookupEnv("GOBU_NAME_SEP"); ok {
+		return sep
+	}
+	return "-"
+}
+
+// archiveComment returns the comment of the zip archives. It is the value of
+// the archive-comment= trait or the GOBU_ARCHIVE_COMMENT environment
+// variable. With the archive-comment trait it describes the build.
+func (g *Gobu) archiveComment() (string, error) {
+	if g.comment != "" {
+		return g.comment, nil
+	}
+	if comment := os.Getenv("GOBU_ARCHIVE_COMMENT"); comment != "" {
+		return comment, nil
+	}
+	if !g.docomment {
+		return "", nil
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s built %s", name, g.Version(),
+		buildTime().Format(time.RFC3339)), nil
+}
+
+// setArchiveComment sets the comment of the zip archive if one is
+// requested.
+func (g *Gobu) setArchiveComment(w *zip.Writer) error {
+	comment, err := g.archiveComment()
+	if err != nil || comment == "" {
+		return err
+	}
+	return w.SetComment(comment)
+}
+
+// createPackage creates a zip package of the built binary and some extra
+// files.
+func (g *Gobu) createPackage(ctx context.Context) error {
+	progname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+	zipfile := fmt.Sprintf("%s.zip", progname)
+
+	files, err := g.packageFiles()
+	if err != nil {
+		return err
+	}
+
+	return createZip(zipfile, func(w *zip.Writer) error {
+		err := g.setArchiveComment(w)
+		if err != nil {
+			return err
+		}
+		return g.writeZipFiles(ctx, w, progname, files)
+	})
+}
+
+// createBundle creates a single zip package of the given builds. Each build
+// is placed in its own os-arch directory.
+func (g *Gobu) createBundle(ctx context.Context, builds []*Gobu) error {
+	progname, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+	progname = strings.Join([]string{progname, g.Version(), "all"}, nameSep())
+
+	builds = append([]*Gobu(nil), builds...)
+	platform := func(b *Gobu) string {
+		return b.TargetOs() + nameSep() + b.TargetArch()
+	}
+	sort.SliceStable(builds, func(i, j int) bool {
+		return platform(builds[i]) < platform(builds[j])
+	})
+
+	return createZip(progname+".zip", func(w *zip.Writer) error {
+		err := g.setArchiveComment(w)
+		if err != nil {
+			return err
+		}
+		for _, b := range builds {
+			if b.auditEnv {
+				err := b.writeAudit()
+				if err != nil {
+					return err
+				}
+			}
+			files, err := b.packageFiles()
+			if err != nil {
+				return err
+			}
+			err = b.writeZipFiles(ctx, w, progname+"/"+platform(b), files)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package build
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	intotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	gobuBuildType       = "https://github.com/kopoli/gobu/provenance/v1"
+	gobuBuilderID       = "https://github.com/kopoli/gobu"
+)
+
+// provenanceSuffix is the suffix of the provenance file of the provenance
+// trait.
+const provenanceSuffix = ".intoto.jsonl"
+
+type intotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaResource struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]interface{} `json:"externalParameters"`
+		InternalParameters   map[string]string      `json:"internalParameters"`
+		ResolvedDependencies []slsaResource         `json:"resolvedDependencies,omitempty"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+type intotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []intotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     slsaProvenance  `json:"predicate"`
+}
+
+// provenanceSubjects returns the built binaries and the created packages
+// with their sha256 digests.
+func (g *Gobu) provenanceSubjects(progname string) ([]intotoSubject, error) {
+	builds := g.suite
+	if len(builds) == 0 {
+		builds = []*Gobu{g}
+	}
+	var files []string
+	for _, b := range builds {
+		binary, err := b.getBinaryPath()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, binary)
+	}
+	for _, f := range []string{progname + ".zip", progname + ".tar",
+		progname + ".tar.zst", progname + "-image.tar"} {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+
+	var ret []intotoSubject
+	for _, f := range files {
+		sum, err := sha256File(f)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, intotoSubject{f, map[string]string{"sha256": sum}})
+	}
+	return ret, nil
+}
+
+// writeProvenance writes an in-toto statement with SLSA provenance of the
+// build next to the packages. The subjects are the binary and the packages.
+// The git commit of the sources is recorded if available.
+func (g *Gobu) writeProvenance() error {
+	progname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+	subjects, err := g.provenanceSubjects(progname)
+	if err != nil {
+		return err
+	}
+	command, _, err := g.Getcmd()
+	if err != nil {
+		return err
+	}
+	traits := g.traits.appliedTraits()
+	sort.Strings(traits)
+
+	st := intotoStatement{
+		Type:          intotoStatementType,
+		Subject:       subjects,
+		PredicateType: slsaProvenanceType,
+	}
+	def := &st.Predicate.BuildDefinition
+	def.BuildType = gobuBuildType
+	def.ExternalParameters = map[string]interface{}{
+		"traits":  traits,
+		"command": command,
+	}
+	def.InternalParameters = map[string]string{
+		"goos":      g.TargetOs(),
+		"goarch":    g.TargetArch(),
+		"goVersion": cmdStr(g.binary, "env", "GOVERSION"),
+		"version":   g.Version(),
+	}
+	if commit := cmdStr("git", "rev-parse", "HEAD"); commit != "" {
+		uri := cmdStr("git", "config", "--get", "remote.origin.url")
+		if uri == "" {
+			uri = "git+file://" + filepath.ToSlash(cmdStr("git", "rev-parse", "--show-toplevel"))
+		}
+		def.ResolvedDependencies = []slsaResource{{
+			URI:    uri,
+			Digest: map[string]string{"gitCommit": commit},
+		}}
+	}
+	st.Predicate.RunDetails.Builder.ID = gobuBuilderID
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(progname+provenanceSuffix, append(data, '\n'), 0644)
+}
@@ -0,0 +1,56 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// proxyFailure tells if the stderr output of the go command contains an
+// error from one of the module proxies of the GOPROXY list.
+func proxyFailure(stderr, goproxy string) bool {
+	if strings.Contains(stderr, "proxyconnect") {
+		return true
+	}
+	for _, p := range strings.FieldsFunc(goproxy, func(r rune) bool {
+		return r == ',' || r == '|'
+	}) {
+		p = strings.TrimSuffix(p, "/")
+		if p == "direct" || p == "off" {
+			continue
+		}
+		if strings.Contains(stderr, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// runWithProxyFallback runs the go command. If the proxy= trait is set and
+// the command fails due to an error of the module proxy, the command is run
+// again with GOPROXY=direct.
+func (g *Gobu) runWithProxyFallback(ctx context.Context, args []string, env []string) error {
+	if g.proxy == "" || g.dockerImage != "" {
+		return g.runCommand(ctx, args, env)
+	}
+
+	var buf bytes.Buffer
+	c := *g
+	c.Stderr = io.MultiWriter(g.Stderr, &buf)
+	err := c.runCommand(ctx, args, env)
+	if err == nil || ctx.Err() != nil || !proxyFailure(buf.String(), g.proxy) {
+		return err
+	}
+
+	if g.Debug {
+		fmt.Fprintf(g.Stdout, "Module proxy %s failed, retrying with GOPROXY=direct\n", g.proxy)
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(env[:len(env):len(env)], "GOPROXY=direct")
+	return g.runCommand(ctx, args, env)
+}
@@ -0,0 +1,135 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// rpmArchs maps GOARCH values to RPM architectures.
+var rpmArchs = map[string]string{
+	"386":     "i686",
+	"amd64":   "x86_64",
+	"arm":     "armv7hl",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// rpmVersion converts the version to an RPM version, which can't contain
+// dashes.
+func rpmVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return "0.0.0"
+	}
+	return strings.ReplaceAll(version, "-", ".")
+}
+
+const rpmSpec = `%%global debug_package %%{nil}
+Name: %[1]s
+Version: %[2]s
+Release: 1
+Summary: %[1]s
+License: Unknown
+BuildArch: %[3]s
+
+%%description
+%[1]s
+
+%%install
+mkdir -p %%{buildroot}/usr/bin
+install -m 0755 %[4]s %%{buildroot}/usr/bin/%[1]s
+
+%%files
+/usr/bin/%[1]s
+`
+
+const rpmNfpmConfig = `name: %[1]s
+version: %[2]s
+arch: %[3]s
+platform: linux
+contents:
+  - src: %[4]s
+    dst: /usr/bin/%[1]s
+    file_info:
+      mode: 0755
+`
+
+// createRpm creates an RPM package with the built binary in /usr/bin. The
+// package is built with rpmbuild or nfpm, whichever is available first.
+func (g *Gobu) createRpm(ctx context.Context) error {
+	if g.TargetOs() != "linux" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping RPM package of a non-linux target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+
+	arch, ok := rpmArchs[g.TargetArch()]
+	if !ok {
+		return fmt.Errorf("unsupported architecture for RPM: %s", g.TargetArch())
+	}
+
+	name, err := g.getBinaryName()
+	if err != nil {
+		return err
+	}
+	binary, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	version := rpmVersion(g.Version())
+
+	tmpdir, err := os.MkdirTemp("", "gobu-rpm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	if _, err := exec.LookPath("rpmbuild"); err == nil {
+		spec := filepath.Join(tmpdir, name+".spec")
+		err = os.WriteFile(spec, []byte(fmt.Sprintf(rpmSpec, name, version, arch, binary)), 0644)
+		if err != nil {
+			return err
+		}
+		err = g.runCommand(ctx, []string{"rpmbuild", "-bb", "--quiet",
+			"--define", "_topdir " + tmpdir, "--target", arch, spec}, nil)
+		if err != nil {
+			return err
+		}
+
+		rpms, err := filepath.Glob(filepath.Join(tmpdir, "RPMS", arch, "*.rpm"))
+		if err != nil {
+			return err
+		}
+		for _, r := range rpms {
+			data, err := os.ReadFile(r)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(filepath.Base(r), data, 0644)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if _, err := exec.LookPath("nfpm"); err == nil {
+		config := filepath.Join(tmpdir, "nfpm.yaml")
+		err = os.WriteFile(config, []byte(fmt.Sprintf(rpmNfpmConfig, name, version,
+			g.TargetArch(), binary)), 0644)
+		if err != nil {
+			return err
+		}
+		return g.runCommand(ctx, []string{"nfpm", "package", "-f", config,
+			"-p", "rpm", "-t", "."}, nil)
+	}
+
+	fmt.Fprintf(g.Stderr, "Warning: Skipping RPM package: neither rpmbuild nor nfpm was found\n")
+	return nil
+}
@@ -0,0 +1,36 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sanitizerTargets lists the GOOS/GOARCH targets supported by the -asan and
+// -msan build flags.
+var sanitizerTargets = map[string][]string{
+	"asan": {"linux/amd64", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64"},
+	"msan": {"linux/amd64", "linux/arm64", "linux/loong64", "freebsd/amd64"},
+}
+
+// unsupportedSanitizers describes the applied sanitizer traits that are not
+// supported on the target.
+func (g *Gobu) unsupportedSanitizers() []string {
+	var ret []string
+	target := g.TargetOs() + "/" + g.TargetArch()
+	for _, s := range []string{"asan", "msan"} {
+		if !g.traits.applied[s] {
+			continue
+		}
+		supported := false
+		for _, t := range sanitizerTargets[s] {
+			if t == target {
+				supported = true
+			}
+		}
+		if !supported {
+			ret = append(ret, fmt.Sprintf("%s is not supported on %s, only on: %s",
+				s, target, strings.Join(sanitizerTargets[s], ", ")))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,177 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// sfxStub is the source of the extractor of the self-extracting archives.
+// It extracts the zip appended to its own executable to the working
+// directory. Existing files are not overwritten and the paths outside the
+// working directory are refused.
+const sfxStub = `package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func extract(f *zip.File) error {
+	name := filepath.Clean(filepath.FromSlash(f.Name))
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("refusing to extract %s", f.Name)
+	}
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(name, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.Mode().Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if e2 := out.Close(); err == nil {
+		err = e2
+	}
+	return err
+}
+
+func run() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	fp, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := zip.NewReader(fp, fi.Size())
+	if err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if err := extract(f); err != nil {
+			return err
+		}
+		fmt.Println(f.Name)
+	}
+	return nil
+}
+
+func main() {
+	code := 0
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		code = 1
+	}
+	fmt.Print("Press Enter to exit")
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	os.Exit(code)
+}
+`
+
+// buildSfxStub builds the extractor of the self-extracting archive for the
+// target architecture to the given directory.
+func (g *Gobu) buildSfxStub(ctx context.Context, dir string) (string, error) {
+	err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(sfxStub), 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gobusfx\n\ngo 1.20\n"), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+	stub := filepath.Join(dir, "stub.exe")
+	cmd := exec.CommandContext(ctx, gobin, "build", "-trimpath", "-ldflags", "-s -w",
+		"-o", stub, ".")
+	cmd.Dir = dir
+	cmd.Env = g.commandEnv([]string{"GOOS=windows", "GOARCH=" + g.TargetArch(),
+		"CGO_ENABLED=0", "GOFLAGS=", "GOWORK=off"})
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		_, _ = g.Stderr.Write(out)
+		return "", err
+	}
+	return stub, nil
+}
+
+// createSfx creates a self-extracting archive <package>.exe of the zip
+// package by prepending an extractor to it. Only for windows targets.
+func (g *Gobu) createSfx(ctx context.Context) (err error) {
+	if g.TargetOs() != "windows" {
+		fmt.Fprintf(g.Stderr, "Warning: Skipping self-extracting archive of a non-windows target: %s/%s\n",
+			g.TargetOs(), g.TargetArch())
+		return nil
+	}
+	progname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+	zipfile := progname + ".zip"
+	payload, err := os.Open(zipfile)
+	if err != nil {
+		return err
+	}
+	defer payload.Close()
+
+	dir, err := os.MkdirTemp("", "gobu-sfx")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	stub, err := g.buildSfxStub(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("building the extractor failed: %w", err)
+	}
+	in, err := os.Open(stub)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	sfxfile := progname + ".exe"
+	out, err := os.OpenFile(sfxfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e2 := out.Close()
+		if err == nil && e2 != nil {
+			err = e2
+		}
+		if err != nil {
+			_ = os.Remove(sfxfile)
+		}
+	}()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, payload)
+	return err
+}
@@ -0,0 +1,51 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// runSmokeTest runs the built binary with the arguments of the smoke= trait
+// and checks that it exits successfully. Cross-compiled binaries are not
+// run. The output of the binary is shown with Debug or if it fails.
+func (g *Gobu) runSmokeTest(ctx context.Context) error {
+	if g.TargetOs() != runtime.GOOS || g.TargetArch() != runtime.GOARCH {
+		fmt.Fprintf(g.Stderr, "Note: Skipping smoke test of a cross-compiled binary: %s/%s\n",
+			g.TargetOs(), g.TargetArch())
+		return nil
+	}
+	if !g.capabilities().output {
+		fmt.Fprintf(g.Stderr, "Note: Skipping smoke test: 'go %s' does not produce a binary\n",
+			g.subcmd)
+		return nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	binary, err = filepath.Abs(binary)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, g.smokeArgs...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if g.Debug {
+		cmd.Stdout = g.Stdout
+		cmd.Stderr = g.Stderr
+	}
+
+	err = cmd.Run()
+	if err != nil {
+		_, _ = buf.WriteTo(g.Stderr)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseSize parses a size in bytes with an optional K, M or G suffix.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	num := strings.ToUpper(strings.TrimSpace(s))
+	num = strings.TrimSuffix(num, "B")
+	if num != "" {
+		switch num[len(num)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	size, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return size * mult, nil
+}
+
+// splitWriter writes to numbered volumes of at most the given size, e.g.
+// app.zip.001, app.zip.002. When closed a manifest with the SHA256 checksums
+// of the volumes is written to <name>.manifest.
+type splitWriter struct {
+	name    string
+	size    int64
+	fp      *os.File
+	hash    hash.Hash
+	written int64
+	volumes []string
+	sums    []string
+}
+
+func (w *splitWriter) closeVolume() error {
+	if w.fp == nil {
+		return nil
+	}
+	err := w.fp.Close()
+	w.fp = nil
+	w.sums = append(w.sums, hex.EncodeToString(w.hash.Sum(nil)))
+	return err
+}
+
+func (w *splitWriter) nextVolume() error {
+	err := w.closeVolume()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s.%03d", w.name, len(w.volumes)+1)
+	w.fp, err = os.Create(name)
+	if err != nil {
+		return err
+	}
+	w.volumes = append(w.volumes, name)
+	w.hash = sha256.New()
+	w.written = 0
+	return nil
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if w.fp == nil || w.written == w.size {
+			if err := w.nextVolume(); err != nil {
+				return n, err
+			}
+		}
+		chunk := p
+		if rest := w.size - w.written; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		m, err := io.MultiWriter(w.fp, w.hash).Write(chunk)
+		n += m
+		w.written += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close closes the last volume and writes the manifest. The manifest is in
+// the format of sha256sum.
+func (w *splitWriter) Close() error {
+	err := w.closeVolume()
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	for i := range w.volumes {
+		fmt.Fprintf(&sb, "%s  %s\n", w.sums[i], w.volumes[i])
+	}
+	return os.WriteFile(w.name+".manifest", []byte(sb.String()), 0644)
+}
+
+// remove removes the written volumes and the manifest.
+func (w *splitWriter) remove() {
+	for _, v := range w.volumes {
+		_ = os.Remove(v)
+	}
+	_ = os.Remove(w.name + ".manifest")
+}
+
+// createArchiveFile creates the archive file and returns it with a function
+// that removes it. If the GOBU_ARCHIVE_SPLIT environment variable is set, the
+// archive is split into volumes of that size.
+func createArchiveFile(name string) (io.WriteCloser, func(), error) {
+	if s := os.Getenv("GOBU_ARCHIVE_SPLIT"); s != "" {
+		size, err := parseSize(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid GOBU_ARCHIVE_SPLIT: %w", err)
+		}
+		w := &splitWriter{name: name, size: size}
+		return w, w.remove, nil
+	}
+
+	fp, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fp, func() { _ = os.Remove(name) }, nil
+}
@@ -0,0 +1,107 @@
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{"1", 1, false},
+		{"100", 100, false},
+		{"2K", 2 << 10, false},
+		{"2k", 2 << 10, false},
+		{"2KB", 2 << 10, false},
+		{"100M", 100 << 20, false},
+		{" 1G ", 1 << 30, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"-1M", 0, true},
+		{"M", 0, true},
+		{"1T", 0, true},
+		{"1.5M", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWriter(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	tests := []struct {
+		size    int64
+		writes  []int
+		volumes []string
+	}{
+		{100, []int{20}, []string{"0123456789abcdefghij"}},
+		{20, []int{20}, []string{"0123456789abcdefghij"}},
+		{8, []int{20}, []string{"01234567", "89abcdef", "ghij"}},
+		{5, []int{3, 3, 14}, []string{"01234", "56789", "abcde", "fghij"}},
+		{1, []int{2, 1}, []string{"0", "1", "2"}},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "app.zip")
+		w := &splitWriter{name: name, size: tt.size}
+		rest := data
+		for _, n := range tt.writes {
+			m, err := w.Write(rest[:n])
+			if err != nil || m != n {
+				t.Fatalf("size %d: Write = %d, %v, want %d", tt.size, m, err, n)
+			}
+			rest = rest[n:]
+		}
+		err := w.Close()
+		if err != nil {
+			t.Fatalf("size %d: Close failed: %v", tt.size, err)
+		}
+
+		var manifest strings.Builder
+		for i, want := range tt.volumes {
+			volume := fmt.Sprintf("%s.%03d", name, i+1)
+			got, err := os.ReadFile(volume)
+			if err != nil {
+				t.Fatalf("size %d: %v", tt.size, err)
+			}
+			if !bytes.Equal(got, []byte(want)) {
+				t.Errorf("size %d: volume %s is %q, want %q", tt.size, volume, got, want)
+			}
+			sum := sha256.Sum256([]byte(want))
+			fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(sum[:]), volume)
+		}
+		if _, err := os.Stat(fmt.Sprintf("%s.%03d", name, len(tt.volumes)+1)); err == nil {
+			t.Errorf("size %d: more than %d volumes written", tt.size, len(tt.volumes))
+		}
+
+		got, err := os.ReadFile(name + ".manifest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != manifest.String() {
+			t.Errorf("size %d: manifest is %q, want %q", tt.size, got, manifest.String())
+		}
+
+		w.remove()
+		files, _ := filepath.Glob(name + "*")
+		if len(files) != 0 {
+			t.Errorf("size %d: remove left files: %v", tt.size, files)
+		}
+	}
+}
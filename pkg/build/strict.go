@@ -0,0 +1,47 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// issueRe matches the issues reported by go vet and staticcheck, e.g.
+// "main.go:12:2: unreachable code".
+var issueRe = regexp.MustCompile(`(?m)^\S+\.go:\d+(?::\d+)?: `)
+
+// isCheck reports whether the command checks the code instead of building
+// it.
+func (g *Gobu) isCheck() bool {
+	return g.subcmd == "vet" || g.subcmd == "staticcheck"
+}
+
+// runStrict runs the check command and fails if it reports any issues,
+// even if it exits successfully. With QuietOnSuccess the output is shown
+// only if the check fails.
+func (g *Gobu) runStrict(ctx context.Context, args []string, env []string) error {
+	var buf bytes.Buffer
+	c := *g
+	c.Stdout = io.MultiWriter(g.Stdout, &buf)
+	c.Stderr = io.MultiWriter(g.Stderr, &buf)
+	if g.QuietOnSuccess {
+		c.QuietOnSuccess = false
+		c.Stdout = &buf
+		c.Stderr = &buf
+	}
+
+	err := c.runWithProxyFallback(ctx, args, env)
+	issues := len(issueRe.FindAllString(buf.String(), -1))
+	if (err != nil || issues > 0) && g.QuietOnSuccess {
+		_, _ = buf.WriteTo(g.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	if issues > 0 {
+		return fmt.Errorf("strict mode: issues reported: %d", issues)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// keepSymbols strips all but the symbols listed in the file from the built
+// binary with objcopy.
+func (g *Gobu) keepSymbols(ctx context.Context, file string) error {
+	if !isElfOs(g.TargetOs()) {
+		fmt.Fprintf(g.Stderr, "Note: Skipping keep-symbols of a non-ELF target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+	if _, err := exec.LookPath("objcopy"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping keep-symbols: objcopy was not found\n")
+		return nil
+	}
+
+	return g.stripBinary(ctx, "--strip-all", "--keep-symbols="+file)
+}
+
+// stripSections removes the given sections from the built binary with
+// objcopy.
+func (g *Gobu) stripSections(ctx context.Context, sections []string) error {
+	if !isElfOs(g.TargetOs()) {
+		fmt.Fprintf(g.Stderr, "Note: Skipping strip-sections of a non-ELF target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+	if _, err := exec.LookPath("objcopy"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping strip-sections: objcopy was not found\n")
+		return nil
+	}
+
+	var args []string
+	for _, s := range sections {
+		args = append(args, "--remove-section="+s)
+	}
+	return g.stripBinary(ctx, args...)
+}
+
+// stripBinary runs objcopy with the given arguments on the built binary and
+// reports the change of its size.
+func (g *Gobu) stripBinary(ctx context.Context, args ...string) error {
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	before, err := os.Stat(binary)
+	if err != nil {
+		return err
+	}
+
+	args = append(append([]string{"objcopy"}, args...), binary)
+	err = g.runCommand(ctx, args, nil)
+	if err != nil {
+		return err
+	}
+
+	after, err := os.Stat(binary)
+	if err != nil {
+		return err
+	}
+	if !g.Quiet {
+		change := fmt.Sprintf("saved %s", formatSize(before.Size()-after.Size()))
+		if after.Size() > before.Size() {
+			change = fmt.Sprintf("grew %s", formatSize(after.Size()-before.Size()))
+		}
+		fmt.Fprintf(g.Stdout, "Stripped %s: %s -> %s (%s)\n", binary,
+			formatSize(before.Size()), formatSize(after.Size()), change)
+	}
+	return nil
+}
+
+// mapSuffix is the suffix of the symbol map file of the linkmap trait.
+const mapSuffix = ".map"
+
+// writeLinkMap writes the symbols of the built binary sorted by address to
+// a map file next to it with 'go tool nm'.
+func (g *Gobu) writeLinkMap(ctx context.Context) error {
+	switch goos := g.TargetOs(); {
+	case isElfOs(goos), goos == "darwin", goos == "ios":
+	default:
+		fmt.Fprintf(g.Stderr, "Warning: Skipping linkmap of a non-ELF and non-Mach-O target: %s\n",
+			goos)
+		return nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+
+	mapfile := binary + mapSuffix
+	fp, err := os.Create(mapfile)
+	if err != nil {
+		return err
+	}
+	c := *g
+	c.Stdout = fp
+	c.QuietOnSuccess = false
+	err = c.runCommand(ctx, []string{gobin, "tool", "nm", "-n", "-size", binary}, nil)
+	if e2 := fp.Close(); err == nil {
+		err = e2
+	}
+	if err != nil {
+		os.Remove(mapfile)
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package build
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// readTarFiles reads the files to be written to a tar archive under the
+// given directory. The file modes are preserved.
+func (g *Gobu) readTarFiles(ctx context.Context, dir string, files []string) ([]tarFile, error) {
+	var ret []tarFile
+	err := g.readPackageFiles(ctx, files, func(i int, data []byte) error {
+		fi, err := os.Stat(files[i])
+		if err != nil {
+			return err
+		}
+		ret = append(ret, tarFile{dir + "/" + g.archivePath(files[i]), int64(fi.Mode().Perm()), data})
+		return nil
+	})
+	return ret, err
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// createTarPackage creates a tar package of the built binary and the extra
+// files with the given file extension. The archive is written through the
+// writer returned by compress. The modification times are the build time.
+func (g *Gobu) createTarPackage(ctx context.Context, ext string,
+	compress func(w io.Writer) (io.WriteCloser, error)) (err error) {
+	progname, err := g.packageName()
+	if err != nil {
+		return err
+	}
+	tarfile := progname + ext
+
+	files, err := g.packageFiles()
+	if err != nil {
+		return err
+	}
+	tfiles, err := g.readTarFiles(ctx, progname, files)
+	if err != nil {
+		return err
+	}
+
+	fp, remove, err := createArchiveFile(tarfile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e2 := fp.Close()
+		if err == nil && e2 != nil {
+			err = e2
+		}
+		if err != nil {
+			remove()
+		}
+	}()
+
+	cw, err := compress(fp)
+	if err != nil {
+		return err
+	}
+	err = writeTar(cw, tfiles, buildTime())
+	if e2 := cw.Close(); err == nil {
+		err = e2
+	}
+	return err
+}
+
+// createTar creates an uncompressed tar package of the built binary and the
+// extra files.
+func (g *Gobu) createTar(ctx context.Context) error {
+	return g.createTarPackage(ctx, ".tar", func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	})
+}
@@ -0,0 +1,217 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildTarget is a single output of a multi-target build.
+type buildTarget struct {
+	goos   string
+	goarch string
+	name   string
+	pkg    string
+
+	// extra link flags and environment variables of the target
+	ldflags []string
+	env     []string
+}
+
+// readTargets reads build targets from a file. Each non-empty line that is
+// not a comment is of the form "os/arch:binaryname".
+func readTargets(file string) ([]buildTarget, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []buildTarget
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		platform, name, ok := strings.Cut(line, ":")
+		goos, goarch, ok2 := strings.Cut(platform, "/")
+		if !ok || !ok2 || goos == "" || goarch == "" || name == "" {
+			return nil, fmt.Errorf("%s:%d: invalid target '%s', expected 'os/arch:binaryname'",
+				file, i+1, line)
+		}
+		ret = append(ret, buildTarget{goos: goos, goarch: goarch, name: name})
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no targets in %s", file)
+	}
+
+	return ret, nil
+}
+
+// forTarget returns a copy of the build configuration that builds the given
+// target.
+func (g *Gobu) forTarget(t buildTarget) *Gobu {
+	ret := *g
+	ret.ldflags = append([]string(nil), g.ldflags...)
+	ret.buildflags = append([]string(nil), g.buildflags...)
+	ret.gcflags = append([]string(nil), g.gcflags...)
+	ret.testflags = append([]string(nil), g.testflags...)
+	ret.environ = append([]string(nil), g.environ...)
+
+	if t.goos != "" {
+		ret.SetEnv("GOOS", t.goos)
+	}
+	if t.goarch != "" {
+		ret.SetEnv("GOARCH", t.goarch)
+	}
+	if t.pkg != "" {
+		ret.cmdargs = []string{t.pkg}
+	}
+	if len(t.ldflags) > 0 {
+		ret.AddLdFlags(t.ldflags...)
+	}
+	for _, e := range t.env {
+		k, v, _ := strings.Cut(e, "=")
+		ret.SetEnv(k, v)
+	}
+	ret.name = t.name
+
+	return &ret
+}
+
+// DefaultAllOs are the operating systems built by default with the all-os
+// trait.
+var DefaultAllOs = []string{"linux", "darwin", "windows"}
+
+// osTargets returns a target of each operating system for the given
+// architecture. The binaries are named <name>-<os>-<arch>.
+func osTargets(oses []string, goarch string) []buildTarget {
+	var ret []buildTarget
+	for _, goos := range oses {
+		ret = append(ret, buildTarget{goos: goos, goarch: goarch,
+			name: fmt.Sprintf("%%n-%s-%s", goos, goarch)})
+	}
+	return ret
+}
+
+// mainTargets returns a target of each main package directory. The
+// binaries are named after the directories.
+func mainTargets(dirs []string) []buildTarget {
+	var ret []buildTarget
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		pkg := filepath.ToSlash(d)
+		if !filepath.IsAbs(d) && pkg != "." && !strings.HasPrefix(pkg, "../") {
+			pkg = "./" + pkg
+		}
+		ret = append(ret, buildTarget{name: filepath.Base(d), pkg: pkg})
+	}
+	return ret
+}
+
+// cmdDir is the directory containing the commands built with the cmds
+// trait.
+const cmdDir = "cmd"
+
+// readCmdTargets returns a build target for each subdirectory of dir that
+// contains go files.
+func readCmdTargets(dir string) ([]buildTarget, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []buildTarget
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(dir, e.Name(), "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		ret = append(ret, buildTarget{
+			name: e.Name(),
+			pkg:  "./" + filepath.ToSlash(filepath.Join(dir, e.Name())),
+		})
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no commands in %s", dir)
+	}
+
+	return ret, nil
+}
+
+// changedCmdTargets returns the targets whose packages or their dependencies
+// have changed since the given git ref. All targets are returned if the
+// changes can't be determined.
+func (g *Gobu) changedCmdTargets(ref string, targets []buildTarget) []buildTarget {
+	report := func(format string, args ...interface{}) {
+		fmt.Fprintf(g.Stderr, format+"\n", args...)
+	}
+
+	if cmdStr("git", "rev-parse", "--verify", "--quiet", ref) == "" {
+		report("Note: Building all commands: %s is not a valid git ref", ref)
+		return targets
+	}
+
+	// Untracked files are changes too, e.g. a new file in a package
+	out := strings.TrimSpace(cmdStr("git", "diff", "--name-only", "--relative", ref) + "\n" +
+		cmdStr("git", "ls-files", "--others", "--exclude-standard"))
+	if out == "" {
+		report("Note: No changes since %s", ref)
+		return nil
+	}
+
+	changed := make(map[string][]string)
+	for _, f := range strings.Split(out, "\n") {
+		f = filepath.FromSlash(strings.TrimSpace(f))
+		switch filepath.Base(f) {
+		case "go.mod", "go.sum":
+			report("Note: Building all commands: %s changed", f)
+			return targets
+		}
+		dir, err := filepath.Abs(filepath.Dir(f))
+		if err != nil {
+			continue
+		}
+		changed[dir] = append(changed[dir], f)
+	}
+
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+
+	var ret []buildTarget
+	for _, t := range targets {
+		deps := cmdStr(gobin, "list", "-deps", "-f", "{{.Dir}}", t.pkg)
+		if deps == "" {
+			report("Note: Building all commands: dependencies of %s could not be listed", t.pkg)
+			return targets
+		}
+
+		reason := ""
+		for _, d := range strings.Split(deps, "\n") {
+			if files, ok := changed[strings.TrimSpace(d)]; ok {
+				reason = strings.Join(files, ", ")
+				break
+			}
+		}
+
+		if reason != "" {
+			report("Selected %s: changed %s", t.pkg, reason)
+			ret = append(ret, t)
+		} else {
+			report("Skipped %s: no changes", t.pkg)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,30 @@
+package build
+
+import "time"
+
+// Timing is the duration of an applied trait or a phase of the build.
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// timing starts timing the named step and returns a function that records
+// its duration. The steps are recorded in the order they are started and
+// only with Debug.
+func (g *Gobu) timing(name string) func() {
+	if !g.Debug {
+		return func() {}
+	}
+	i := len(g.timings)
+	g.timings = append(g.timings, Timing{Name: name})
+	start := time.Now()
+	return func() {
+		g.timings[i].Duration = time.Since(start)
+	}
+}
+
+// Timings returns the durations of the applied traits and the phases of the
+// build. They are recorded only with Debug. Nested traits are indented.
+func (g *Gobu) Timings() []Timing {
+	return g.timings
+}
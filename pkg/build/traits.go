@@ -0,0 +1,837 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type traitdesc struct {
+	help       string
+	trait      func()
+	paramTrait func(string)
+	validate   func(string) error
+
+	// repeatable traits are applied each time they are given
+	repeatable bool
+}
+
+type descmap map[string]traitdesc
+
+func (d *descmap) add(name, help string, trait func()) {
+	(*d)[name] = traitdesc{
+		help:       help,
+		trait:      trait,
+		paramTrait: nil,
+	}
+}
+
+// addChecked adds a trait whose preconditions are checked with validate
+// before any traits are applied.
+func (d *descmap) addChecked(name, help string, validate func() error, trait func()) {
+	(*d)[name] = traitdesc{
+		help:       help,
+		trait:      trait,
+		paramTrait: nil,
+		validate: func(string) error {
+			return validate()
+		},
+	}
+}
+
+func (d *descmap) addFlag(name, help string, trait func(string)) {
+	(*d)[name] = traitdesc{
+		help:       help,
+		trait:      nil,
+		paramTrait: trait,
+	}
+}
+
+// addValidatedFlag adds a parameterized trait whose value is checked with
+// validate before any traits are applied.
+func (d *descmap) addValidatedFlag(name, help string, validate func(string) error, trait func(string)) {
+	(*d)[name] = traitdesc{
+		help:       help,
+		trait:      nil,
+		paramTrait: trait,
+		validate:   validate,
+	}
+}
+
+// addRepeatableFlag adds a validated parameterized trait that is applied
+// each time it is given instead of only the first time.
+func (d *descmap) addRepeatableFlag(name, help string, validate func(string) error, trait func(string)) {
+	d.addValidatedFlag(name, help, validate, trait)
+	t := (*d)[name]
+	t.repeatable = true
+	(*d)[name] = t
+}
+
+// oneOf returns a validator that accepts only the given values.
+func oneOf(values ...string) func(string) error {
+	return func(s string) error {
+		for i := range values {
+			if s == values[i] {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of: %s", strings.Join(values, ", "))
+	}
+}
+
+// nonEmpty validates that the value is not empty.
+func nonEmpty(s string) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+// fileExists validates that the value is an existing file.
+func fileExists(s string) error {
+	fi, err := os.Stat(s)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", s)
+	}
+	return nil
+}
+
+// filesExist validates that the value is a comma-separated list of
+// existing files.
+func filesExist(s string) error {
+	for _, f := range strings.Split(s, ",") {
+		err := fileExists(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirsExist validates that the value is a comma-separated list of existing
+// directories.
+func dirsExist(s string) error {
+	for _, d := range strings.Split(s, ",") {
+		fi, err := os.Stat(d)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", d)
+		}
+	}
+	return nil
+}
+
+// noSpaces validates that the value has no whitespace.
+func noSpaces(s string) error {
+	if strings.ContainsAny(s, " \t\n\r") {
+		return fmt.Errorf("must not contain whitespace")
+	}
+	return nil
+}
+
+// positiveInt validates that the value is a positive integer.
+func positiveInt(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 {
+		return fmt.Errorf("must be a positive integer")
+	}
+	return nil
+}
+
+type gobutraits struct {
+	traits  descmap
+	applied map[string]bool
+
+	// explanation of the applied traits if explaining is set
+	explaining  bool
+	explanation []string
+	depth       int
+
+	// timing starts timing a trait, see Gobu.timing
+	timing func(name string) func()
+}
+
+func newgobutraits(gb *Gobu) *gobutraits {
+	var ret = &gobutraits{
+		applied: make(map[string]bool),
+	}
+	gb.record = ret.record
+	ret.timing = gb.timing
+	t := make(descmap)
+
+	t.add("nocgo", "Set 'CGO_ENABLED=0' environment variable.", func() {
+		gb.SetEnv("CGO_ENABLED", "0")
+	})
+	t.add("nosumdb", "Set 'GOSUMDB=off' environment variable to not verify modules with the checksum database.", func() {
+		gb.SetEnv("GOSUMDB", "off")
+	})
+	t.add("static", "Set '-extldflags \"-static\"' link flags.", func() {
+		gb.AddLdFlags("-extldflags", `"-static"`)
+	})
+	t.add("auditenv", "Add a build-audit.txt of the command, environment and versions of the build to the packages.", func() {
+		gb.auditEnv = true
+	})
+	t.add("musl", "Set 'CC=musl-gcc' and 'CGO_ENABLED=1' environment variables and the static trait.", func() {
+		if _, err := exec.LookPath("musl-gcc"); err != nil {
+			fmt.Fprintf(gb.Stderr, "Warning: musl-gcc was not found in PATH, it is needed by the musl trait\n")
+		}
+		gb.SetEnv("CC", "musl-gcc")
+		gb.SetEnv("CGO_ENABLED", "1")
+		ret.apply("static")
+	})
+	t.add("shrink", "Set '-s -w' link flags.", func() {
+		gb.AddLdFlags("-s", "-w")
+	})
+	t.addChecked("pgo", "Set '-pgo=default.pgo' build flag for profile-guided optimization.", func() error {
+		return fileExists("default.pgo")
+	}, func() {
+		gb.AddBuildFlags("-pgo=default.pgo")
+	})
+	t.add("race", "Set '-race' build flag.", func() {
+		gb.AddBuildFlags("-race")
+	})
+	t.add("asan", "Set '-asan' build flag and 'CGO_ENABLED=1' environment variable.", func() {
+		gb.AddBuildFlags("-asan")
+		gb.SetEnv("CGO_ENABLED", "1")
+	})
+	t.add("msan", "Set '-msan' build flag and 'CGO_ENABLED=1' environment variable.", func() {
+		gb.AddBuildFlags("-msan")
+		gb.SetEnv("CGO_ENABLED", "1")
+	})
+	t.add("rebuild", "Set '-a' build flag.", func() {
+		gb.AddBuildFlags("-a")
+	})
+	t.add("trimpath", "Set '-trimpath' build flag.", func() {
+		gb.AddBuildFlags("-trimpath")
+	})
+	t.add("linux", "Set 'GOOS=linux' environment variable.", func() {
+		gb.SetEnv("GOOS", "linux")
+	})
+	t.add("windows", "Set 'GOOS=windows' environment variable.", func() {
+		gb.SetEnv("GOOS", "windows")
+	})
+	t.add("windowsgui", "Set windows trait and '-H windowsgui' link flag.", func() {
+		ret.apply("windows")
+		gb.AddLdFlags("-H", "windowsgui")
+	})
+	t.add("verbose", "Set '-v' build flag.", func() {
+		gb.AddBuildFlags("-v")
+	})
+	t.add("deb", "After building creates a Debian package of a linux binary.", func() {
+		gb.dodeb = true
+	})
+	t.add("debug", "Set '-x' build flag.", func() {
+		gb.AddBuildFlags("-x")
+	})
+	t.add("install", "Run 'go install' instead of 'go build'.", func() {
+		gb.subcmd = "install"
+	})
+	t.add("run", "Run 'go run' instead of 'go build'. Arguments after '--' are passed to it.", func() {
+		gb.subcmd = "run"
+	})
+	t.add("verify-reproducible", "Sets the trimpath trait and verifies that building twice gives identical binaries.", func() {
+		ret.apply("trimpath")
+		if os.Getenv("SOURCE_DATE_EPOCH") == "" {
+			if ct := cmdStr("git", "log", "-1", "--format=%ct"); ct != "" {
+				gb.SetEnv("SOURCE_DATE_EPOCH", ct)
+			}
+		}
+		gb.replaceVar(gb.versionVar("timestamp"), buildTime().Format(time.RFC3339))
+		gb.verifyReproducible = true
+	})
+	t.add("split-debug", "After building moves the debug symbols to a separate '.debug' file with objcopy.", func() {
+		gb.splitDebug = true
+	})
+	t.add("staticcheck", "Run 'staticcheck ./...' instead of 'go build'. Skipped if staticcheck is not found.", func() {
+		gb.subcmd = "staticcheck"
+	})
+	t.add("print-version", "Print the version of the build instead of building.", func() {
+		gb.printVersion = true
+	})
+	t.add("goenv", "Run 'go env' instead of 'go build' to show the environment of the build.", func() {
+		gb.subcmd = "env"
+	})
+	t.add("all-os", "Build for linux, darwin and windows on the target architecture.", func() {
+		gb.allOs = true
+	})
+	t.add("macos-universal", "Build for darwin on amd64 and arm64 and combine them to a universal binary with lipo.", func() {
+		gb.macUniversal = true
+	})
+	t.add("cmds", "Build each command in the subdirectories of 'cmd'.", func() {
+		gb.buildCmds = true
+	})
+	t.add("cpuprofile", "Set '-cpuprofile cpu.prof' test flag.", func() {
+		gb.AddTestFlags("-cpuprofile", "cpu.prof")
+	})
+	t.add("memprofile", "Set '-memprofile mem.prof' test flag.", func() {
+		gb.AddTestFlags("-memprofile", "mem.prof")
+	})
+	t.add("test", "Run 'go test' instead of 'go build'. Tests './...' by default.", func() {
+		gb.subcmd = "test"
+	})
+	t.add("cover", "Set '-cover' test flag.", func() {
+		gb.AddTestFlags("-cover")
+	})
+	t.add("shuffle", "Set '-shuffle=on' test flag to run the tests in random order.", func() {
+		gb.AddTestFlags("-shuffle=on")
+	})
+	t.add("version",
+		"Set 'timestamp', 'version', 'buildGOOS' and 'buildGOARCH' go variables to the package set by versionpkg= (default 'main').", func() {
+			gb.AddVar(gb.versionVar("timestamp"), buildTime().Format(time.RFC3339))
+			gb.AddVar(gb.versionVar("version"), gb.Version())
+			gb.AddVar(gb.versionVar("buildGOOS"), runtime.GOOS)
+			gb.AddVar(gb.versionVar("buildGOARCH"), runtime.GOARCH)
+		})
+	t.add("depshash", "Set 'depsHash' go variable to the 'main' package to the sha256 hash of go.sum.", func() {
+		hash, err := depsHash()
+		switch {
+		case err != nil:
+			fmt.Fprintf(gb.Stderr, "Warning: Skipping depshash: %s\n", err)
+		case hash == "":
+			fmt.Fprintf(gb.Stderr, "Note: Skipping depshash: no go.sum found\n")
+		default:
+			gb.AddVar("main.depsHash", hash)
+		}
+	})
+	t.add("tag-verified", "Set 'tagVerified' go variable to the 'main' package telling if the tag of the commit is signed.", func() {
+		gb.AddVar("main.tagVerified", strconv.FormatBool(tagVerified()))
+	})
+	t.add("package", "After building creates a zip-package of the binary.", func() {
+		gb.dopackage = true
+	})
+	t.add("verify-static", "After building verifies that the binary is not dynamically linked.", func() {
+		gb.verifyStatic = true
+	})
+	t.add("verify-nocgo", "After building verifies that the binary does not use cgo.", func() {
+		gb.verifyNoCgo = true
+	})
+	t.add("tidy-check", "Before building runs 'go mod tidy' and fails if it changes go.mod or go.sum.", func() {
+		gb.tidyCheck = true
+	})
+	t.add("clean-tree", "Before building verifies that the git working tree has no uncommitted changes.", func() {
+		gb.cleanTree = true
+	})
+	t.add("debugbuild", "Set 'all=-N -l' compile flags to disable optimizations and inlining.", func() {
+		gb.AddCompileFlags("all=-N -l")
+	})
+	t.add("archive-comment", "Set a comment describing the build to the zip packages.", func() {
+		gb.docomment = true
+	})
+	t.add("brew", "Sets the package trait and creates a Homebrew formula of the packages.", func() {
+		ret.apply("package")
+		gb.dobrew = true
+	})
+	t.add("sfx", "Sets the package trait and creates a self-extracting archive of the windows package.", func() {
+		ret.apply("package")
+		gb.dosfx = true
+	})
+	t.add("notarize", "Sets the package trait and submits the macOS package to the Apple notary service.", func() {
+		ret.apply("package")
+		gb.donotarize = true
+	})
+	t.add("bundle", "With multiple targets creates a single zip-package of all of them.", func() {
+		gb.dobundle = true
+	})
+	t.add("changelog", "Generate a CHANGELOG of the commits since the previous tag to the packages.", func() {
+		gb.dochangelog = true
+	})
+	t.add("linkmap", "After building writes the symbols of the binary to a '.map' file.", func() {
+		gb.linkmap = true
+	})
+	t.add("oci", "After building creates an OCI image tarball of a linux binary.", func() {
+		gb.dooci = true
+	})
+	t.add("tar", "After building creates an uncompressed tar-package of the binary.", func() {
+		gb.dotar = true
+	})
+	t.add("zst", "After building creates a zstd compressed tar-package of the binary.", func() {
+		gb.dozst = true
+	})
+	t.add("private", "Sets the trimpath trait, removes local paths from cgo and verifies that the binary contains no local paths.", func() {
+		ret.apply("trimpath")
+		gb.verifyPaths = true
+		if len(gb.cgoCflags) == 0 {
+			gb.cgoCflags = []string{cgoFlags("CGO_CFLAGS")}
+		}
+		gb.cgoCflags = append(gb.cgoCflags, trimCgoPaths()...)
+		gb.SetEnv("CGO_CFLAGS", strings.Join(gb.cgoCflags, " "))
+		gb.SetEnv("CGO_CXXFLAGS", strings.Join(append([]string{cgoFlags("CGO_CXXFLAGS")},
+			trimCgoPaths()...), " "))
+	})
+	t.add("provenance", "After building writes SLSA provenance of the binary and the packages to an '.intoto.jsonl' file.", func() {
+		gb.provenance = true
+	})
+	t.add("rpm", "After building creates an RPM package of a linux binary with rpmbuild or nfpm.", func() {
+		gb.dorpm = true
+	})
+	t.add("release", "Sets the traits: shrink, version, static, rebuild and trimpath.", func() {
+		ret.apply("shrink", "version", "static", "rebuild", "trimpath")
+	})
+	t.add("default", "Sets the version trait. This is used if run without arguments.", func() {
+		ret.apply("version")
+	})
+
+	t.addRepeatableFlag("cgo-cflags=", "Add to the 'CGO_CFLAGS' environment variable.",
+		nonEmpty, func(s string) {
+			gb.cgoCflags = append(gb.cgoCflags, s)
+			gb.SetEnv("CGO_CFLAGS", strings.Join(gb.cgoCflags, " "))
+		})
+	t.addRepeatableFlag("cgo-ldflags=", "Add to the 'CGO_LDFLAGS' environment variable.",
+		nonEmpty, func(s string) {
+			gb.cgoLdflags = append(gb.cgoLdflags, s)
+			gb.SetEnv("CGO_LDFLAGS", strings.Join(gb.cgoLdflags, " "))
+		})
+	t.addValidatedFlag("zigcc=", "Use 'zig cc' for the given target triple as the C compiler and set 'CGO_ENABLED=1'.",
+		validateZigTarget, func(s string) {
+			gb.SetEnv("CC", "zig cc -target "+s)
+			gb.SetEnv("CXX", "zig c++ -target "+s)
+			gb.SetEnv("CGO_ENABLED", "1")
+			gb.zigTarget = s
+		})
+	t.addValidatedFlag("docker=", "Run the go command in a container of the given image. Pin with 'image@sha256:...'.",
+		validateDockerImage, func(s string) {
+			gb.dockerImage = s
+		})
+	t.addFlag("go=", "Set the 'go' binary explicitly.", func(s string) {
+		gb.binary = s
+	})
+	t.addFlag("tags=", "Set 'go build -tags' explicitly.", func(s string) {
+		gb.AddBuildFlags("-tags", s)
+	})
+	t.addFlag("ldflags=", "Set 'go tool link' flags explicitly.", func(s string) {
+		gb.ResetLdFlags()
+		gb.AddLdFlags(s)
+	})
+	t.addFlag("buildflags=", "Set 'go build' flags explicitly.", func(s string) {
+		gb.ResetBuildFlags()
+		gb.AddBuildFlags(s)
+	})
+	t.addFlag("gcflags=", "Set 'go tool compile' flags explicitly.", func(s string) {
+		gb.ResetCompileFlags()
+		gb.AddCompileFlags(s)
+	})
+	t.addRepeatableFlag("addgcflags=", "Add to the 'go tool compile' flags. The flags can be prefixed with a package pattern.",
+		nonEmpty, func(s string) {
+			gb.AddCompileFlags(s)
+		})
+	t.addValidatedFlag("keep-symbols=", "Set '-w' link flag and strip all symbols except the ones listed in the given file with objcopy.",
+		fileExists, func(s string) {
+			gb.AddLdFlags("-w")
+			gb.keepSymbolsFile = s
+		})
+	t.addValidatedFlag("linkbuildid=", "Set '-buildid' link flag to the given build ID. 'none' sets it empty.",
+		noSpaces, func(s string) {
+			if s == "none" {
+				s = ""
+			}
+			gb.AddLdFlags("-buildid=" + s)
+		})
+	t.addValidatedFlag("mod=", "Set '-mod' build flag. Either 'mod', 'vendor' or 'readonly'.",
+		oneOf("mod", "vendor", "readonly"), func(s string) {
+			gb.AddBuildFlags("-mod=" + s)
+		})
+	t.addValidatedFlag("archive-comment=", "Set the given comment to the zip packages.",
+		nonEmpty, func(s string) {
+			gb.comment = s
+			gb.note("archive comment: %s", s)
+		})
+	t.addValidatedFlag("buildvcs=", "Set '-buildvcs' build flag. Either 'true', 'false' or 'auto'.",
+		oneOf("true", "false", "auto"), func(s string) {
+			gb.AddBuildFlags("-buildvcs=" + s)
+		})
+	t.addValidatedFlag("cpuprofile=", "Set '-cpuprofile' test flag with the given output file.",
+		nonEmpty, func(s string) {
+			gb.AddTestFlags("-cpuprofile", s)
+		})
+	t.addValidatedFlag("memprofile=", "Set '-memprofile' test flag with the given output file.",
+		nonEmpty, func(s string) {
+			gb.AddTestFlags("-memprofile", s)
+		})
+	t.addValidatedFlag("proxy=", "Set 'GOPROXY' environment variable. Retries with 'GOPROXY=direct' if the proxy fails.",
+		nonEmpty, func(s string) {
+			gb.SetEnv("GOPROXY", s)
+			gb.proxy = s
+		})
+	t.addValidatedFlag("version=", "Set the version used by the version trait and the packages.",
+		nonEmpty, func(s string) {
+			gb.version = s
+			gb.replaceVar(gb.versionVar("version"), s)
+			gb.note("version: %s", s)
+		})
+	t.addValidatedFlag("versionpkg=", "Set the package of the version trait variables instead of 'main'.",
+		func(s string) error {
+			if err := nonEmpty(s); err != nil {
+				return err
+			}
+			return noSpaces(s)
+		}, func(s string) {
+			gb.setVersionPkg(s)
+		})
+	t.addValidatedFlag("versions=", "Build and package each of the given comma-separated git tags.",
+		nonEmpty, func(s string) {
+			for _, v := range strings.Split(s, ",") {
+				v = strings.TrimSpace(v)
+				if v != "" {
+					gb.versions = append(gb.versions, v)
+				}
+			}
+			gb.note("versions: %s", strings.Join(gb.versions, " "))
+		})
+	t.addValidatedFlag("embed=", "Embed the given comma-separated files to the 'assets' variable of the 'main' package.",
+		filesExist, func(s string) {
+			gb.embedFiles = append(gb.embedFiles, strings.Split(s, ",")...)
+			gb.note("embedded files: %s", s)
+		})
+	t.addRepeatableFlag("goexperiment=", "Add to the 'GOEXPERIMENT' environment variable to enable experimental toolchain features.",
+		nonEmpty, func(s string) {
+			gb.goexperiments = append(gb.goexperiments, s)
+			gb.SetEnv("GOEXPERIMENT", strings.Join(gb.goexperiments, ","))
+		})
+	t.addRepeatableFlag("goprivate=", "Add to the 'GOPRIVATE' environment variable the module patterns that are private.",
+		func(s string) error {
+			if err := nonEmpty(s); err != nil {
+				return err
+			}
+			return noSpaces(s)
+		}, func(s string) {
+			gb.goprivate = append(gb.goprivate, s)
+			gb.SetEnv("GOPRIVATE", strings.Join(gb.goprivate, ","))
+		})
+	t.addValidatedFlag("gomaxprocs=", "Set 'GOMAXPROCS' environment variable to limit the parallelism of the build.",
+		positiveInt, func(s string) {
+			gb.SetEnv("GOMAXPROCS", s)
+		})
+	t.addValidatedFlag("buildid=", "Set 'buildID' go variable to the 'main' package. Uses the CI build ID if empty.",
+		func(s string) error {
+			if s == "" && ciBuildID() == "" {
+				return fmt.Errorf("must not be empty outside CI (%s)",
+					strings.Join(ciBuildIDVars, ", "))
+			}
+			if strings.Contains(s, "'") && strings.Contains(s, `"`) {
+				return fmt.Errorf("must not contain both single and double quotes")
+			}
+			return nil
+		}, func(s string) {
+			if s == "" {
+				s = ciBuildID()
+			}
+			gb.AddVar("main.buildID", s)
+		})
+	t.addValidatedFlag("copyto=", "After building copies the binary to the given file or directory.",
+		nonEmpty, func(s string) {
+			gb.copyTo = s
+		})
+	t.addValidatedFlag("covermode=", "Set '-covermode' test flag. Either 'set', 'count' or 'atomic'.",
+		oneOf("set", "count", "atomic"), func(s string) {
+			gb.AddTestFlags("-covermode=" + s)
+		})
+	t.addValidatedFlag("nfpm=", "After building creates packages with nfpm using the given configuration.",
+		fileExists, func(s string) {
+			gb.nfpmConfig = s
+		})
+	t.addValidatedFlag("pgo=", "Set '-pgo' build flag with the given profile.",
+		fileExists, func(s string) {
+			gb.AddBuildFlags("-pgo=" + s)
+		})
+	t.addValidatedFlag("testpkg=", "Set the package pattern to test. Defaults to './...'.",
+		nonEmpty, func(s string) {
+			gb.testpkg = s
+		})
+	t.addValidatedFlag("checklinkname=", "Set '-checklinkname' link flag. Either '0' or '1'.",
+		oneOf("0", "1"), func(s string) {
+			gb.AddLdFlags("-checklinkname=" + s)
+		})
+	t.addValidatedFlag("compressdwarf=", "Set '-compressdwarf' link flag. Either 'true' or 'false'.",
+		oneOf("true", "false"), func(s string) {
+			gb.AddLdFlags("-compressdwarf=" + s)
+		})
+	t.addValidatedFlag("count=", "Set '-count' test flag to run the tests the given number of times.",
+		positiveInt, func(s string) {
+			gb.AddTestFlags("-count=" + s)
+		})
+	t.addValidatedFlag("testrun=", "Set '-run' test flag to select the tests to run.",
+		nonEmpty, func(s string) {
+			gb.AddTestFlags("-run", s)
+		})
+	t.addValidatedFlag("staticcheck=", "Sets the staticcheck trait and passes the given arguments to staticcheck.",
+		nonEmpty, func(s string) {
+			ret.apply("staticcheck")
+			gb.staticcheckArgs = append(gb.staticcheckArgs, strings.Fields(s)...)
+			gb.note("staticcheck arguments: %s", s)
+		})
+	t.addValidatedFlag("mains=", "Build the given comma-separated main package directories and package them together.",
+		dirsExist, func(s string) {
+			gb.mainPkgs = strings.Split(s, ",")
+		})
+	t.addValidatedFlag("matrix-file=", "Build each target of the given JSON build matrix file.",
+		fileExists, func(s string) {
+			gb.matrixFile = s
+		})
+	t.addValidatedFlag("winsign=", "After building signs the windows binary with the given PKCS#12 certificate or certificate store thumbprint with signtool or osslsigncode.",
+		validateWinsign, func(s string) {
+			gb.winsignCert = s
+		})
+	t.addValidatedFlag("manpages=", "Add the man pages of the given directory to the packages under man/.",
+		dirsExist, func(s string) {
+			gb.manPages = s
+		})
+	t.addFlag("valgrind=", "After building runs the binary under valgrind with the given arguments and reports memory errors and leaks.", func(s string) {
+		gb.valgrind = true
+		gb.valgrindArgs = strings.Fields(s)
+	})
+	t.addValidatedFlag("gen-completion=", "Add the shell completions printed by the given subcommand of the binary to the packages.",
+		nonEmpty, func(s string) {
+			gb.completionCmd = strings.Fields(s)
+		})
+	t.addFlag("smoke=", "After building runs the binary with the given arguments and checks that it succeeds.", func(s string) {
+		gb.smoke = true
+		gb.smokeArgs = strings.Fields(s)
+	})
+	t.addValidatedFlag("strip-sections=", "After building removes the given comma-separated ELF sections with objcopy.",
+		func(s string) error {
+			if err := nonEmpty(s); err != nil {
+				return err
+			}
+			return noSpaces(s)
+		}, func(s string) {
+			gb.removeSects = strings.Split(s, ",")
+		})
+	t.addFlag("targets=", "Build each 'os/arch:binaryname' line of the given file.", func(s string) {
+		gb.targetsFile = s
+	})
+	t.addFlag("name=", "Set binary name with the -o build flag. %n, %v, %o and %a represent the original name, version, OS and architecture.", func(s string) {
+		gb.name = s
+	})
+	ret.traits = t
+
+	return ret
+}
+
+func isFlagTrait(name string) bool {
+	return strings.Contains(name, "=")
+}
+
+func parseTrait(name string) string {
+	return strings.SplitAfter(name, "=")[0]
+}
+
+func (g *gobutraits) check(names ...string) error {
+	inv := make(map[string]bool)
+
+	for i := range names {
+		n := parseTrait(names[i])
+		if _, ok := g.traits[n]; !ok {
+			inv[n] = true
+		}
+	}
+
+	suffix := "s"
+	switch len(inv) {
+	case 0:
+		return g.checkValues(names...)
+	case 1:
+		suffix = ""
+	}
+
+	var invalid []string
+	for k := range inv {
+		if s := g.suggest(k); s != "" {
+			k = fmt.Sprintf("%s (did you mean %s?)", k, s)
+		}
+		invalid = append(invalid, k)
+	}
+	sort.Strings(invalid)
+
+	return fmt.Errorf("invalid trait%s: %s", suffix, strings.Join(invalid, ", "))
+}
+
+// maxSuggestDistance is the largest edit distance for which a trait name is
+// suggested in place of an invalid one.
+const maxSuggestDistance = 2
+
+// suggest returns the trait name closest to the given invalid name or an
+// empty string if there is no close enough match.
+func (g *gobutraits) suggest(name string) string {
+	best := ""
+	bestDist := maxSuggestDistance + 1
+	for k := range g.traits {
+		d := levenshtein(name, k)
+		if d < bestDist || (d == bestDist && k < best) {
+			best = k
+			bestDist = d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between strings a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func (g *gobutraits) checkValues(names ...string) error {
+	for i := range names {
+		n := parseTrait(names[i])
+		t := g.traits[n]
+		if t.validate == nil {
+			continue
+		}
+		if !isFlagTrait(n) {
+			if err := t.validate(""); err != nil {
+				return fmt.Errorf("trait %s: %s", n, err)
+			}
+			continue
+		}
+		value := strings.SplitN(names[i], "=", 2)[1]
+		if err := t.validate(value); err != nil {
+			return fmt.Errorf("invalid value '%s' for trait %s: %s", value, n, err)
+		}
+	}
+	return nil
+}
+
+func (g *gobutraits) record(effect string) {
+	if g.explaining {
+		g.explanation = append(g.explanation, strings.Repeat("  ", g.depth)+effect)
+	}
+}
+
+func (g *gobutraits) apply(names ...string) {
+	for i := range names {
+		n := parseTrait(names[i])
+		if _, ok := g.applied[n]; ok && !g.traits[n].repeatable {
+			g.record(fmt.Sprintf("%s: already applied", names[i]))
+			continue
+		}
+		if t, ok := g.traits[n]; ok {
+			g.record(fmt.Sprintf("%s: %s", names[i], t.help))
+			done := g.timing(strings.Repeat("  ", g.depth) + "trait " + names[i])
+			g.depth++
+			if isFlagTrait(n) {
+				t.paramTrait(strings.SplitN(names[i], "=", 2)[1])
+			} else {
+				t.trait()
+			}
+			g.depth--
+			done()
+			g.applied[n] = true
+		}
+	}
+}
+
+func (g *gobutraits) appliedTraits() []string {
+	var ret []string
+
+	for k, v := range g.applied {
+		if v {
+			ret = append(ret, k)
+		}
+	}
+
+	return ret
+}
+
+// conflictingTraits lists pairs of traits that should not be used together.
+var conflictingTraits = [][2]string{
+	{"shrink", "debugbuild"},
+	{"shrink", "split-debug"},
+	{"shrink", "keep-symbols="},
+	{"shrink", "linkmap"},
+	{"nocgo", "zigcc="},
+	{"nocgo", "asan"},
+	{"nocgo", "msan"},
+	{"nocgo", "musl"},
+	{"musl", "zigcc="},
+	{"race", "asan"},
+	{"race", "msan"},
+	{"asan", "msan"},
+}
+
+// conflicts returns descriptions of the conflicting applied traits.
+func (g *gobutraits) conflicts() []string {
+	var ret []string
+	for _, c := range conflictingTraits {
+		if g.applied[c[0]] && g.applied[c[1]] {
+			ret = append(ret, fmt.Sprintf("traits %s and %s conflict", c[0], c[1]))
+		}
+	}
+	return ret
+}
+
+// Trait describes a trait that can be applied to a build.
+type Trait struct {
+	Name string
+	Help string
+}
+
+// IsParameterized tells if the named trait takes a value, e.g. "name=".
+func IsParameterized(name string) bool {
+	return isFlagTrait(name)
+}
+
+// Traits returns the available traits sorted by name.
+func (g *Gobu) Traits() []Trait {
+	var ret []Trait
+	for k, v := range g.traits.traits {
+		ret = append(ret, Trait{Name: k, Help: v.help})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// HasTrait tells if the given trait exists. A parameterized trait may be
+// given with or without its value.
+func (g *Gobu) HasTrait(name string) bool {
+	_, ok := g.traits.traits[parseTrait(name)]
+	return ok
+}
+
+// Explain checks and applies the given traits and returns a description of
+// the effects of each trait.
+func (g *Gobu) Explain(traits ...string) ([]string, error) {
+	err := g.traits.check(traits...)
+	if err != nil {
+		return nil, &ParseError{"Parsing traits failed", err}
+	}
+
+	g.traits.explaining = true
+	g.traits.apply(traits...)
+	g.traits.explaining = false
+
+	return g.traits.explanation, nil
+}
+
+// TraitName returns the name of the trait without its value, e.g. "name=" for
+// "name=foo".
+func TraitName(trait string) string {
+	return parseTrait(trait)
+}
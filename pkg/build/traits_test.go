@@ -0,0 +1,49 @@
+package build
+
+import (
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"nocgo", "nocgo", 0},
+		{"nocg", "nocgo", 1},
+		{"shirnk", "shrink", 2},
+		{"kitten", "sitting", 3},
+		{"äö", "ao", 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tr := newgobutraits(&Gobu{})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"nocg", "nocgo"},
+		{"shirnk", "shrink"},
+		{"relase", "release"},
+		{"nmae=", "name="},
+		{"xyzzy", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := tr.suggest(tt.name); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
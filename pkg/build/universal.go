@@ -0,0 +1,67 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// universalArchs are the architectures combined to a universal macOS
+// binary.
+var universalArchs = []string{"amd64", "arm64"}
+
+// universalTargets returns the darwin targets of the macos-universal trait.
+// The binaries are named <name>-darwin-<arch>.
+func universalTargets() []buildTarget {
+	var ret []buildTarget
+	for _, goarch := range universalArchs {
+		ret = append(ret, osTargets([]string{"darwin"}, goarch)...)
+	}
+	return ret
+}
+
+// findLipo checks that lipo is available.
+func findLipo() error {
+	_, err := exec.LookPath("lipo")
+	if err != nil {
+		return fmt.Errorf("lipo was not found in PATH, it is only available on macOS")
+	}
+	return nil
+}
+
+// createUniversal combines the darwin builds to a universal binary with
+// lipo. It returns the build configuration of the universal binary, which is
+// then packaged.
+func (g *Gobu) createUniversal(ctx context.Context, builds []*Gobu) (*Gobu, error) {
+	ret := *g
+	ret.givenOs = "darwin"
+	ret.givenArch = "universal"
+	ret.builds = nil
+
+	output, err := ret.getBinaryPath()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"lipo", "-create", "-output", output}
+	for _, b := range builds {
+		binary, err := b.getBinaryPath()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, binary)
+	}
+
+	if g.Debug || g.DryRun {
+		fmt.Fprintf(g.Stdout, "Universal binary:\n%s\n", strings.Join(args, " "))
+	}
+	if g.DryRun {
+		return &ret, nil
+	}
+
+	err = g.runCommand(ctx, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
@@ -0,0 +1,76 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+)
+
+// valgrindErrorsRe matches the summary of the errors found by valgrind.
+var valgrindErrorsRe = regexp.MustCompile(`ERROR SUMMARY: (\d+) errors`)
+
+// runValgrind runs the built binary under valgrind with the arguments of the
+// valgrind= trait and reports the memory errors and leaks it finds. The
+// errors fail the build only with Strict. Cross-compiled binaries are not
+// run.
+func (g *Gobu) runValgrind(ctx context.Context) error {
+	if g.TargetOs() != runtime.GOOS || g.TargetArch() != runtime.GOARCH {
+		fmt.Fprintf(g.Stderr, "Note: Skipping valgrind of a cross-compiled binary: %s/%s\n",
+			g.TargetOs(), g.TargetArch())
+		return nil
+	}
+	if !g.capabilities().output {
+		fmt.Fprintf(g.Stderr, "Note: Skipping valgrind: 'go %s' does not produce a binary\n",
+			g.subcmd)
+		return nil
+	}
+	if _, err := exec.LookPath("valgrind"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping valgrind: valgrind was not found\n")
+		return nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	binary, err = filepath.Abs(binary)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	args := append([]string{"--leak-check=full", binary}, g.valgrindArgs...)
+	cmd := exec.CommandContext(ctx, "valgrind", args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if g.Debug {
+		cmd.Stdout = io.MultiWriter(g.Stdout, &buf)
+		cmd.Stderr = io.MultiWriter(g.Stderr, &buf)
+	}
+
+	err = cmd.Run()
+	errors := 0
+	if m := valgrindErrorsRe.FindStringSubmatch(buf.String()); m != nil {
+		errors, _ = strconv.Atoi(m[1])
+	}
+	if (err != nil || errors > 0) && !g.Debug {
+		_, _ = buf.WriteTo(g.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	if errors == 0 {
+		return nil
+	}
+	if g.Strict {
+		return fmt.Errorf("valgrind reported errors: %d", errors)
+	}
+	fmt.Fprintf(g.Stderr, "Warning: valgrind reported errors: %d\n", errors)
+	return nil
+}
@@ -0,0 +1,275 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// verifyCleanTree checks that the git working tree has no uncommitted
+// changes.
+func verifyCleanTree() error {
+	if cmdStr("git", "rev-parse", "--is-inside-work-tree") != "true" {
+		return fmt.Errorf("not inside a git working tree")
+	}
+	status := cmdStr("git", "status", "--porcelain")
+	if status != "" {
+		return fmt.Errorf("uncommitted changes:\n%s", status)
+	}
+	return nil
+}
+
+// tagVerified tells if the checked out commit has a tag whose signature is
+// verified by 'git tag -v'.
+func tagVerified() bool {
+	tag := cmdStr("git", "describe", "--exact-match", "--tags", "HEAD")
+	if tag == "" {
+		return false
+	}
+	return exec.Command("git", "tag", "-v", tag).Run() == nil
+}
+
+// verifyNoCgoBinary checks with 'go tool nm' that the built binary does not
+// contain the runtime/cgo package. Binaries without a symbol table are
+// skipped.
+func (g *Gobu) verifyNoCgoBinary(ctx context.Context) error {
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	gobin := g.binary
+	if gobin == "" {
+		gobin = "go"
+	}
+
+	out, err := exec.CommandContext(ctx, gobin, "tool", "nm", binary).CombinedOutput()
+	if err != nil {
+		if bytes.Contains(out, []byte("no symbols")) {
+			fmt.Fprintf(g.Stderr, "Note: Skipping cgo verification: %s has no symbols\n", binary)
+			return nil
+		}
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		sym := fields[len(fields)-1]
+		if strings.HasPrefix(sym, "runtime/cgo.") {
+			return fmt.Errorf("%s uses cgo: found symbol %s", binary, sym)
+		}
+	}
+	return nil
+}
+
+// firstDifference returns the offset of the first differing byte of a and
+// b.
+func firstDifference(a, b []byte) int {
+	for i := range a {
+		if i >= len(b) || a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
+
+// verifyReproducibleBuild builds the binary twice to temporary directories
+// and checks that the binaries are identical. The second build is done with
+// the -a flag so that no cached results are reused.
+func (g *Gobu) verifyReproducibleBuild(ctx context.Context, env []string) error {
+	if !g.capabilities().output || g.dockerImage != "" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping reproducibility verification of 'go %s'\n",
+			g.subcmd)
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp("", "gobu-reproducible")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	var binaries [2][]byte
+	for i := range binaries {
+		c := *g
+		c.name = filepath.Join(tmp, fmt.Sprint(i), "%n")
+		if i > 0 {
+			c.buildflags = append(append([]string(nil), g.buildflags...), "-a")
+		}
+		args, _, err := c.Getcmd()
+		if err != nil {
+			return err
+		}
+		err = c.runCommand(ctx, args, env)
+		if err != nil {
+			return err
+		}
+		path, err := c.getBinaryPath()
+		if err != nil {
+			return err
+		}
+		binaries[i], err = os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Equal(binaries[0], binaries[1]) {
+		return fmt.Errorf("binaries differ at byte offset %d: sha256 %x != %x",
+			firstDifference(binaries[0], binaries[1]),
+			sha256.Sum256(binaries[0]), sha256.Sum256(binaries[1]))
+	}
+	return nil
+}
+
+// debugSuffix is the suffix of the file of the split-debug trait.
+const debugSuffix = ".debug"
+
+// splitDebugInfo moves the debug symbols of the built binary to a separate
+// file and adds a debuglink to it in the binary.
+func (g *Gobu) splitDebugInfo(ctx context.Context) error {
+	if !isElfOs(g.TargetOs()) {
+		fmt.Fprintf(g.Stderr, "Warning: Skipping split-debug of a non-ELF target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+	if _, err := exec.LookPath("objcopy"); err != nil {
+		fmt.Fprintf(g.Stderr, "Note: Skipping split-debug: objcopy was not found\n")
+		return nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	debug := binary + debugSuffix
+
+	err = g.runCommand(ctx, []string{"objcopy", "--only-keep-debug", binary, debug}, nil)
+	if err != nil {
+		return err
+	}
+	// The debuglink is looked up by the base name next to the binary
+	return g.runCommand(ctx, []string{"objcopy", "--strip-debug",
+		"--add-gnu-debuglink=" + debug, binary}, nil)
+}
+
+// isElfOs tells if binaries of the given GOOS are ELF files.
+func isElfOs(goos string) bool {
+	switch goos {
+	case "windows", "darwin", "ios", "plan9", "aix", "js", "wasip1":
+		return false
+	}
+	return true
+}
+
+// verifyStaticBinary checks that the built binary has no program
+// interpreter and links no shared libraries.
+func (g *Gobu) verifyStaticBinary() error {
+	if !isElfOs(g.TargetOs()) {
+		fmt.Fprintf(g.Stderr, "Note: Skipping static verification of a non-ELF target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+
+	f, err := elf.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return fmt.Errorf("binary %s requests a program interpreter", binary)
+		}
+	}
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return err
+	}
+	if len(libs) > 0 {
+		return fmt.Errorf("binary %s is dynamically linked against: %s",
+			binary, strings.Join(libs, ", "))
+	}
+
+	return nil
+}
+
+// localPaths returns the local directories that should not appear in a
+// distributed binary.
+func localPaths() []string {
+	var ret []string
+	if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+		ret = append(ret, home)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		ret = append(ret, wd)
+	}
+	if wd, err := filepath.EvalSymlinks("."); err == nil {
+		if abs, err := filepath.Abs(wd); err == nil && (len(ret) == 0 || abs != ret[len(ret)-1]) {
+			ret = append(ret, abs)
+		}
+	}
+	return ret
+}
+
+// trimCgoPaths returns the C compiler flags that remove the local paths from
+// the file names that cgo compiles into the binary. The paths are not given
+// with -gcflags, because the go command records it in the build information
+// of the binary. The cgo flags are left out of it with -trimpath.
+func trimCgoPaths() []string {
+	var ret []string
+	for _, p := range localPaths() {
+		ret = append(ret, "-ffile-prefix-map="+p+"=.")
+	}
+	return ret
+}
+
+// cgoFlags returns the C compiler flags of the environment variable or the
+// default flags of the go command.
+func cgoFlags(key string) string {
+	if flags := os.Getenv(key); flags != "" {
+		return flags
+	}
+	return "-O2 -g"
+}
+
+// verifyNoLocalPaths checks that the built binary does not contain the home
+// directory of the user or the working directory.
+func (g *Gobu) verifyNoLocalPaths() error {
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(binary)
+	if err != nil {
+		return err
+	}
+
+	var leaked []string
+	for _, p := range localPaths() {
+		if n := bytes.Count(data, []byte(p)); n > 0 {
+			leaked = append(leaked, fmt.Sprintf("%s (%d times)", p, n))
+		}
+	}
+	if len(leaked) > 0 {
+		return fmt.Errorf("binary %s contains local paths: %s",
+			binary, strings.Join(leaked, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// versionFile is the file in the module root that contains the version.
+const versionFile = "VERSION"
+
+// defaultVersion is used if the version can't be determined otherwise.
+const defaultVersion = "dev"
+
+// readVersionFile returns the trimmed content of the VERSION file in the
+// module root, or in the working directory outside modules.
+func readVersionFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if root, err := findModule(dir); err == nil {
+		dir = root
+	}
+	data, err := os.ReadFile(filepath.Join(dir, versionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Version returns the version of the build. It is the value of the
+// version= trait, the content of the VERSION file, the output of 'git
+// describe' or "dev", in that order. The version is resolved when first
+// needed.
+func (g *Gobu) Version() string {
+	if g.version == "" {
+		g.version = readVersionFile()
+	}
+	if g.version == "" {
+		g.version = cmdStr("git", "describe", "--always", "--tags", "--dirty")
+	}
+	if g.version == "" {
+		g.version = defaultVersion
+	}
+	return g.version
+}
+
+// defaultVersionPkg is the package prefix of the version trait variables.
+const defaultVersionPkg = "main."
+
+// versionVars are the go variables set by the version trait.
+var versionVars = []string{"timestamp", "version", "buildGOOS", "buildGOARCH"}
+
+// versionVar returns the full name of the given version trait variable.
+func (g *Gobu) versionVar(name string) string {
+	return g.versionPkg + name
+}
+
+// setVersionPkg sets the package prefix of the version trait variables. The
+// variables already set with the old prefix are renamed.
+func (g *Gobu) setVersionPkg(pkg string) {
+	if !strings.HasSuffix(pkg, ".") {
+		pkg += "."
+	}
+	for i := range g.ldflags {
+		if i == 0 || g.ldflags[i-1] != "-X" {
+			continue
+		}
+		for _, v := range versionVars {
+			old := g.versionVar(v) + "="
+			flag := strings.Trim(g.ldflags[i], `'"`)
+			if strings.HasPrefix(flag, old) {
+				g.ldflags[i] = quoteFlag(pkg + v + "=" + strings.TrimPrefix(flag, old))
+			}
+		}
+	}
+	g.versionPkg = pkg
+}
@@ -0,0 +1,49 @@
+package build
+
+import (
+	"strings"
+	"testing"
+)
+
+// xVars returns the go variables set with -X link flags.
+func xVars(g *Gobu) map[string]string {
+	ret := map[string]string{}
+	for i := 1; i < len(g.ldflags); i++ {
+		if g.ldflags[i-1] != "-X" {
+			continue
+		}
+		kv := strings.SplitN(strings.Trim(g.ldflags[i], `'"`), "=", 2)
+		if len(kv) == 2 {
+			ret[kv[0]] = kv[1]
+		}
+	}
+	return ret
+}
+
+func TestVersionPkg(t *testing.T) {
+	const pkg = "github.com/x/y/internal/build."
+	tests := []struct {
+		traits []string
+		prefix string
+	}{
+		{[]string{"version=1.2.3", "version"}, "main."},
+		{[]string{"version=1.2.3", "versionpkg=" + pkg, "version"}, pkg},
+		{[]string{"version=1.2.3", "version", "versionpkg=" + pkg}, pkg},
+		{[]string{"version=1.2.3", "versionpkg=" + strings.TrimSuffix(pkg, "."), "version"}, pkg},
+	}
+	for _, tt := range tests {
+		g := newTestGobu(t, tt.traits...)
+		vars := xVars(g)
+		if len(vars) != len(versionVars) {
+			t.Errorf("%v: -X variables are %v, want %d", tt.traits, vars, len(versionVars))
+		}
+		for _, v := range versionVars {
+			if _, ok := vars[tt.prefix+v]; !ok {
+				t.Errorf("%v: %s%s is not set: %v", tt.traits, tt.prefix, v, vars)
+			}
+		}
+		if got := vars[tt.prefix+"version"]; got != "1.2.3" {
+			t.Errorf("%v: %sversion = %q, want %q", tt.traits, tt.prefix, got, "1.2.3")
+		}
+	}
+}
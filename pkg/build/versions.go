@@ -0,0 +1,95 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// forVersion returns a copy of the build configuration with the given
+// version. The version variable of the version trait is updated.
+func (g *Gobu) forVersion(version string) *Gobu {
+	ret := *g
+	ret.ldflags = append([]string(nil), g.ldflags...)
+	ret.builds = nil
+	ret.replaceVar(ret.versionVar("version"), version)
+	ret.version = version
+
+	return &ret
+}
+
+// currentRef returns the checked out branch or the commit if HEAD is
+// detached.
+func currentRef() string {
+	ref := cmdStr("git", "symbolic-ref", "--quiet", "--short", "HEAD")
+	if ref == "" {
+		ref = cmdStr("git", "rev-parse", "HEAD")
+	}
+	return ref
+}
+
+// runVersions checks out, builds and packages each version of the
+// versions= trait. The originally checked out ref is restored afterwards.
+func (g *Gobu) runVersions(ctx context.Context) error {
+	if g.DryRun {
+		for _, v := range g.versions {
+			fmt.Fprintf(g.Stdout, "Version %s:\n", v)
+			err := g.forVersion(v).run(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := verifyCleanTree()
+	if err != nil {
+		return &BuildError{"Working tree is not clean", err}
+	}
+
+	orig := currentRef()
+	if orig == "" {
+		return &BuildError{"Building versions failed",
+			fmt.Errorf("could not determine the current git ref")}
+	}
+	defer func() {
+		err := g.runCommand(context.Background(),
+			[]string{"git", "checkout", "--quiet", orig}, nil)
+		if err != nil {
+			fmt.Fprintf(g.Stderr, "Error: Restoring git ref %s failed: %s\n",
+				orig, err)
+		}
+	}()
+
+	var failed []string
+	var report []string
+	for _, v := range g.versions {
+		err := g.runCommand(ctx, []string{"git", "checkout", "--quiet", v}, nil)
+		if err != nil {
+			err = &BuildError{"Checking out version failed", err}
+		} else {
+			b := g.forVersion(cmdStr("git", "describe", "--always", "--tags"))
+			err = b.run(ctx)
+			if err == nil {
+				err = b.createPackages(ctx)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			failed = append(failed, v)
+			report = append(report, fmt.Sprintf("  %s: %s", v, err))
+		} else {
+			report = append(report, fmt.Sprintf("  %s: ok", v))
+		}
+	}
+
+	fmt.Fprintf(g.Stdout, "Versions:\n%s\n", strings.Join(report, "\n"))
+	if len(failed) > 0 {
+		return &BuildError{"Building versions failed",
+			fmt.Errorf("failed versions: %s", strings.Join(failed, ", "))}
+	}
+	return nil
+}
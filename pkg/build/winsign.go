@@ -0,0 +1,179 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// defaultTimestampURL is the RFC 3161 timestamp server of the winsign=
+// trait if GOBU_WINSIGN_TIMESTAMP is not set.
+const defaultTimestampURL = "http://timestamp.digicert.com"
+
+// timestampURL returns the RFC 3161 timestamp server used when signing.
+func timestampURL() string {
+	if url := os.Getenv("GOBU_WINSIGN_TIMESTAMP"); url != "" {
+		return url
+	}
+	return defaultTimestampURL
+}
+
+// thumbprintRe matches the SHA-1 thumbprint of a certificate in the Windows
+// certificate store.
+var thumbprintRe = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+
+// isThumbprint tells if the winsign= certificate is a thumbprint of a
+// certificate in the certificate store instead of a file.
+func isThumbprint(cert string) bool {
+	if _, err := os.Stat(cert); err == nil {
+		return false
+	}
+	return thumbprintRe.MatchString(cert)
+}
+
+// validateWinsign checks that the certificate of the winsign= trait exists
+// and that a tool to sign with it is found.
+func validateWinsign(cert string) error {
+	if isThumbprint(cert) {
+		if _, err := exec.LookPath("signtool"); err != nil {
+			return fmt.Errorf("signing with the certificate store needs signtool in PATH")
+		}
+		return nil
+	}
+	err := fileExists(cert)
+	if err == nil {
+		_, err = findSignTool()
+	}
+	return err
+}
+
+// findSignTool returns signtool if it is found and otherwise osslsigncode.
+func findSignTool() (string, error) {
+	for _, tool := range []string{"signtool", "osslsigncode"} {
+		if _, err := exec.LookPath(tool); err == nil {
+			return tool, nil
+		}
+	}
+	return "", fmt.Errorf("neither signtool nor osslsigncode was found in PATH")
+}
+
+// signArgs returns the command that signs the binary with the certificate
+// of the winsign= trait. signtool selects a certificate of the certificate
+// store by its thumbprint or takes the password of a certificate file on the
+// command line. osslsigncode reads the password from passfile and writes the
+// signed binary to a separate file.
+func (g *Gobu) signArgs(tool, binary, signed, password, passfile string) []string {
+	if tool == "signtool" {
+		args := []string{tool, "sign", "/f", g.winsignCert}
+		if isThumbprint(g.winsignCert) {
+			args = []string{tool, "sign", "/sha1", g.winsignCert}
+		} else if password != "" {
+			args = append(args, "/p", password)
+		}
+		return append(args, "/fd", "sha256", "/tr", timestampURL(), "/td", "sha256", binary)
+	}
+	args := []string{tool, "sign", "-pkcs12", g.winsignCert}
+	if passfile != "" {
+		args = append(args, "-readpass", passfile)
+	}
+	return append(args, "-h", "sha256", "-ts", timestampURL(), "-in", binary, "-out", signed)
+}
+
+// signCommand returns the command that signs the built binary with the
+// password file of osslsigncode, and the command to show to the user, where
+// the password is hidden.
+func (g *Gobu) signCommand(passfile string) (args []string, shown []string, err error) {
+	tool, err := findSignTool()
+	if err != nil {
+		return nil, nil, err
+	}
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	password := os.Getenv("GOBU_WINSIGN_PASSWORD")
+	hidden := ""
+	if password != "" {
+		hidden = "***"
+	} else {
+		passfile = ""
+	}
+	signed := binary + ".signed"
+	return g.signArgs(tool, binary, signed, password, passfile),
+		g.signArgs(tool, binary, signed, hidden, passfile), nil
+}
+
+// writePassFile writes the password of the certificate to a temporary file
+// readable only by the user. The returned function removes the file.
+func writePassFile() (string, func(), error) {
+	fp, err := os.CreateTemp("", "gobu-winsign")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { _ = os.Remove(fp.Name()) }
+	_, err = fp.WriteString(os.Getenv("GOBU_WINSIGN_PASSWORD"))
+	if e2 := fp.Close(); err == nil {
+		err = e2
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return fp.Name(), remove, nil
+}
+
+// signBinary signs the built windows binary with Authenticode and
+// timestamps the signature.
+func (g *Gobu) signBinary(ctx context.Context) error {
+	if g.TargetOs() != "windows" {
+		fmt.Fprintf(g.Stderr, "Note: Skipping winsign of a non-windows target: %s\n",
+			g.TargetOs())
+		return nil
+	}
+	tool, err := findSignTool()
+	if err != nil {
+		return err
+	}
+	passfile := ""
+	if os.Getenv("GOBU_WINSIGN_PASSWORD") != "" && !isThumbprint(g.winsignCert) {
+		if tool == "signtool" {
+			fmt.Fprintf(g.Stderr, "Warning: signtool takes the certificate password on the command line, where other users can see it\n")
+		} else {
+			var remove func()
+			passfile, remove, err = writePassFile()
+			if err != nil {
+				return err
+			}
+			defer remove()
+		}
+	}
+
+	args, shown, err := g.signCommand(passfile)
+	if err != nil {
+		return err
+	}
+	if g.Debug {
+		fmt.Fprintf(g.Stdout, "Sign:\n%s\n", strings.Join(shown, " "))
+	}
+
+	err = g.runCommand(ctx, args, nil)
+	if err != nil {
+		return err
+	}
+	if tool != "osslsigncode" {
+		return nil
+	}
+	binary, err := g.getBinaryPath()
+	if err != nil {
+		return err
+	}
+	signed := binary + ".signed"
+	err = os.Rename(signed, binary)
+	if err != nil {
+		_ = os.Remove(signed)
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package build
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// zigArchs and zigOses map the parts of zig target triples to GOARCH and
+// GOOS values.
+var (
+	zigArchs = map[string]string{
+		"x86_64":  "amd64",
+		"x86":     "386",
+		"aarch64": "arm64",
+		"arm":     "arm",
+		"riscv64": "riscv64",
+	}
+	zigOses = map[string]string{
+		"linux":   "linux",
+		"macos":   "darwin",
+		"windows": "windows",
+		"freebsd": "freebsd",
+	}
+)
+
+// validateZigTarget checks that zig is installed and the value is a target
+// triple.
+func validateZigTarget(s string) error {
+	if _, err := exec.LookPath("zig"); err != nil {
+		return fmt.Errorf("zig was not found in PATH, see https://ziglang.org/download/")
+	}
+	if parts := strings.Split(s, "-"); len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("must be a target triple such as x86_64-linux-musl")
+	}
+	return nil
+}
+
+// zigTargetMismatch describes the difference between the zig target triple
+// and the target of the go build. An empty string is returned if they match
+// or the triple is not known.
+func (g *Gobu) zigTargetMismatch(triple string) string {
+	parts := strings.Split(triple, "-")
+	goarch, okArch := zigArchs[parts[0]]
+	goos, okOs := zigOses[parts[1]]
+	if okArch && goarch != g.TargetArch() {
+		return fmt.Sprintf("zig target %s is not for GOARCH=%s", triple, g.TargetArch())
+	}
+	if okOs && goos != g.TargetOs() {
+		return fmt.Sprintf("zig target %s is not for GOOS=%s", triple, g.TargetOs())
+	}
+	return ""
+}
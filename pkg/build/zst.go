@@ -0,0 +1,42 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultZstdLevel is the zstd compression level if GOBU_ZSTD_LEVEL is not
+// set.
+const defaultZstdLevel = 3
+
+// zstdLevel returns the compression level from the GOBU_ZSTD_LEVEL
+// environment variable.
+func zstdLevel() (int, error) {
+	s := os.Getenv("GOBU_ZSTD_LEVEL")
+	if s == "" {
+		return defaultZstdLevel, nil
+	}
+	level, err := strconv.Atoi(s)
+	if err != nil || level < 1 || level > 22 {
+		return 0, fmt.Errorf("invalid GOBU_ZSTD_LEVEL '%s': must be between 1 and 22", s)
+	}
+	return level, nil
+}
+
+// createZst creates a zstd compressed tar package of the built binary and
+// the extra files.
+func (g *Gobu) createZst(ctx context.Context) error {
+	level, err := zstdLevel()
+	if err != nil {
+		return err
+	}
+
+	return g.createTarPackage(ctx, ".tar.zst", func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	})
+}